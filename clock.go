@@ -0,0 +1,165 @@
+package procreader
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// AT_CLKTCK from include/uapi/linux/auxvec.h, the auxv entry with USER_HZ
+const AT_CLKTCK = 17
+
+// the value of USER_HZ on all current architectures, used if auxv is missing
+const defaultClockTicks uint64 = 100
+
+// readClockTicks returns sysconf(_SC_CLK_TCK), which glibc gets from the
+// AT_CLKTCK entry in the auxiliary vector (pairs of native words).
+func readClockTicks(cfg *procConfig) (uint64, error) {
+	contents, err := readContents(cfg, "/self/auxv", "self/auxv")
+	if err != nil {
+		// eg. a copy of /proc
+		if isUnavailable(err) || isPermission(err) {
+			return defaultClockTicks, nil
+		}
+		return 0, wrapError(err)
+	}
+
+	size := int(unsafe.Sizeof(uintptr(0)))
+	for i := 0; i+2*size <= len(contents); i += 2 * size {
+		var key, val uint64
+
+		if size == 8 {
+			key = binary.NativeEndian.Uint64([]byte(contents[i:]))
+			val = binary.NativeEndian.Uint64([]byte(contents[i+size:]))
+		} else {
+			key = uint64(binary.NativeEndian.Uint32([]byte(contents[i:])))
+			val = uint64(binary.NativeEndian.Uint32([]byte(contents[i+size:])))
+		}
+		if key == AT_CLKTCK && val > 0 {
+			return val, nil
+		}
+	}
+
+	return defaultClockTicks, nil
+}
+
+// readBootTime returns the 'btime' (boot time in seconds since the epoch) from
+// /proc/stat.
+func readBootTime(cfg *procConfig) (time.Time, error) {
+	lines, err := readSystemLines(cfg, "stat")
+	if err != nil {
+		return time.Time{}, wrapError(err)
+	}
+
+	for n, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		btime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, parseError("stat", n+1, "btime", err)
+		}
+		return time.Unix(btime, 0), nil
+	}
+
+	return time.Time{}, parseError("stat", 0, "btime", errors.New("no 'btime' line"))
+}
+
+// ticksToDuration converts clock ticks without overflowing for large values.
+func ticksToDuration(ticks uint64, hz uint64) time.Duration {
+	return time.Duration(ticks/hz)*time.Second +
+		time.Duration(ticks%hz)*time.Second/time.Duration(hz)
+}
+
+func startTime(boot time.Time, hz uint64, proc *Proc) time.Time {
+	return boot.Add(ticksToDuration(proc.Stat.Start_time, hz))
+}
+
+func elapsed(boot time.Time, hz uint64, proc *Proc, now time.Time) time.Duration {
+	d := now.Sub(startTime(boot, hz, proc))
+	if d < 0 {
+		// btime is rounded to seconds
+		return 0
+	}
+	return d
+}
+
+func (r *Reader) readClock() (time.Time, uint64, error) {
+	r.clockMu.Lock()
+	defer r.clockMu.Unlock()
+
+	if !r.clockRead {
+		cfg := r.config()
+		cfg.contents = make(map[string]string)
+
+		hz, err := readClockTicks(&cfg)
+		if err != nil {
+			return time.Time{}, 0, wrapError(err)
+		}
+		boot, err := readBootTime(&cfg)
+		if err != nil {
+			return time.Time{}, 0, wrapError(err)
+		}
+		r.clockBoot, r.clockTicks, r.clockRead = boot, hz, true
+	}
+
+	return r.clockBoot, r.clockTicks, nil
+}
+
+// This function returns the number of clock ticks per second (USER_HZ), the
+// unit of Stat_t.Utime, Stime, Start_time, etc.
+func ClockTicks() (uint64, error) {
+	return defaultReader.ClockTicks()
+}
+
+// ClockTicks is ClockTicks() for the proc filesystem in r. It's read along
+// with the boot time, and both are kept once that succeeds.
+func (r *Reader) ClockTicks() (uint64, error) {
+	_, hz, err := r.readClock()
+	return hz, err
+}
+
+// This function returns the time the system booted, from /proc/stat.
+func BootTime() (time.Time, error) {
+	return defaultReader.BootTime()
+}
+
+// BootTime is BootTime() for the proc filesystem in r.
+func (r *Reader) BootTime() (time.Time, error) {
+	boot, _, err := r.readClock()
+	return boot, err
+}
+
+// This function returns the wall clock time the process started.
+func StartTime(proc *Proc) (time.Time, error) {
+	return defaultReader.StartTime(proc)
+}
+
+// StartTime is StartTime() for a process read from r.
+func (r *Reader) StartTime(proc *Proc) (time.Time, error) {
+	boot, hz, err := r.readClock()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return startTime(boot, hz, proc), nil
+}
+
+// This function returns how long the process has been running.
+func Elapsed(proc *Proc) (time.Duration, error) {
+	return defaultReader.Elapsed(proc)
+}
+
+// Elapsed is Elapsed() for a process read from r.
+func (r *Reader) Elapsed(proc *Proc) (time.Duration, error) {
+	boot, hz, err := r.readClock()
+	if err != nil {
+		return 0, err
+	}
+
+	return elapsed(boot, hz, proc, time.Now()), nil
+}
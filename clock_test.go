@@ -0,0 +1,161 @@
+package procreader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+	"unsafe"
+)
+
+// auxv builds the contents of /proc/<pid>/auxv from key, value pairs
+func auxv(pairs ...uint64) string {
+	var buf []byte
+
+	size := int(unsafe.Sizeof(uintptr(0)))
+	for _, word := range pairs {
+		b := make([]byte, size)
+		if size == 8 {
+			binary.NativeEndian.PutUint64(b, word)
+		} else {
+			binary.NativeEndian.PutUint32(b, uint32(word))
+		}
+		buf = append(buf, b...)
+	}
+
+	return string(buf)
+}
+
+func TestReadClockTicks(t *testing.T) {
+	var tests = []struct {
+		name     string
+		contents map[string]string
+		expect   uint64
+	}{
+		// AT_PAGESZ, AT_CLKTCK, AT_NULL
+		{"auxv", map[string]string{"/self/auxv": auxv(6, 4096, AT_CLKTCK, 1024, 0, 0)}, 1024},
+		{"no AT_CLKTCK", map[string]string{"/self/auxv": auxv(6, 4096, 0, 0)}, defaultClockTicks},
+		{"no auxv", map[string]string{}, defaultClockTicks},
+	}
+
+	for _, test := range tests {
+		var cfg procConfig
+
+		cfg.fsys = dirFS("/nonexistent/path")
+		cfg.contents = test.contents
+
+		hz, err := readClockTicks(&cfg)
+		if err != nil {
+			t.Errorf("readClockTicks(%s): %v\n", test.name, err)
+			continue
+		}
+		if hz != test.expect {
+			t.Errorf("readClockTicks(%s): expected %d, got %d\n", test.name, test.expect, hz)
+			continue
+		}
+		fmt.Printf("ok readClockTicks(%s) == %d\n", test.name, hz)
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	var cfg procConfig
+	var proc Proc
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"/stat": "cpu  100 0 100 1000 0 0 0 0 0 0\nintr 0\nctxt 1234\nbtime 1425970000\nprocesses 500\n",
+	}
+
+	boot, err := readBootTime(&cfg)
+	if err != nil {
+		t.Fatalf("readBootTime(): %v\n", err)
+	}
+	if boot.Unix() != 1425970000 {
+		t.Fatalf("readBootTime(): expected 1425970000, got %d\n", boot.Unix())
+	}
+	fmt.Printf("ok readBootTime() == %d\n", boot.Unix())
+
+	// 1 hour, 250ms after boot
+	proc.Stat.Start_time = 360025
+	start := startTime(boot, 100, &proc)
+	expect := boot.Add(time.Hour + 250*time.Millisecond)
+	if !start.Equal(expect) {
+		t.Errorf("startTime(): expected %v, got %v\n", expect, start)
+	} else {
+		fmt.Printf("ok startTime() == %v\n", start)
+	}
+
+	d := elapsed(boot, 100, &proc, expect.Add(90*time.Second))
+	if d != 90*time.Second {
+		t.Errorf("elapsed(): expected 90s, got %v\n", d)
+	} else {
+		fmt.Printf("ok elapsed() == %v\n", d)
+	}
+
+	d = elapsed(boot, 100, &proc, boot)
+	if d != 0 {
+		t.Errorf("elapsed(): expected 0 for a start in the future, got %v\n", d)
+	} else {
+		fmt.Printf("ok elapsed() == 0 before start\n")
+	}
+
+	// ~300 years of ticks at 1000 HZ would overflow ticks * time.Second
+	if ticksToDuration(1<<43, 1000) <= 0 {
+		t.Errorf("ticksToDuration(): overflowed\n")
+	} else {
+		fmt.Printf("ok ticksToDuration() large values\n")
+	}
+
+	cfg.contents["/stat"] = "cpu  100 0 100 1000 0 0 0 0 0 0\n"
+	_, err = readBootTime(&cfg)
+	if err == nil {
+		t.Errorf("readBootTime(): expected error without btime\n")
+	} else {
+		fmt.Printf("ok readBootTime() failed: %v\n", err)
+	}
+}
+
+func TestBootTime(t *testing.T) {
+	hz, err := ClockTicks()
+	if err != nil || hz == 0 {
+		t.Fatalf("ClockTicks(): %d %v\n", hz, err)
+	}
+	fmt.Printf("ok ClockTicks() == %d\n", hz)
+
+	boot, err := BootTime()
+	if err != nil {
+		t.Fatalf("BootTime(): %v\n", err)
+	}
+	if !boot.Before(time.Now()) || boot.Before(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("BootTime(): unlikely %v\n", boot)
+		return
+	}
+	fmt.Printf("ok BootTime() == %v\n", boot)
+}
+
+func TestBootTimeRetry(t *testing.T) {
+	// /proc/stat isn't there yet (eg. a copy still being made)
+	fsys := fstest.MapFS{}
+	r := NewReader(fsys)
+
+	_, err := r.BootTime()
+	if err == nil || !isUnavailable(err) {
+		t.Fatalf("BootTime(): expected missing stat, got %v\n", err)
+	}
+	fmt.Printf("ok BootTime() without stat: %v\n", err)
+
+	// the failure wasn't kept, but the result is
+	fsys["stat"] = &fstest.MapFile{Data: []byte("btime 1425987800\n")}
+	boot, err := r.BootTime()
+	if err != nil || boot.Unix() != 1425987800 {
+		t.Fatalf("BootTime(): expected 1425987800, got %v (%v)\n", boot, err)
+	}
+	delete(fsys, "stat")
+	boot, err = r.BootTime()
+	if err != nil || boot.Unix() != 1425987800 {
+		t.Errorf("BootTime(): expected the first read, got %v (%v)\n", boot, err)
+	} else {
+		fmt.Printf("ok BootTime() read once it's there\n")
+	}
+}
@@ -0,0 +1,252 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CPUSample is the CPU usage of a process between two calls to
+// CPUSampler.Sample(). Percentages are of one CPU (like top), so a process
+// can use up to 100 * <number of CPUs>.
+type CPUSample struct {
+	Pid     uint64
+	User    float64 // % of a CPU spent in user mode
+	System  float64 // % of a CPU spent in kernel mode
+	Total   float64 // User + System
+	Started bool    // process started during the interval (which may mean its PID was reused)
+	Unknown bool    // no previous sample (eg. the first call, or it wasn't passed last time)
+}
+
+// CPUUsage is the result of CPUSampler.Sample().
+type CPUUsage struct {
+	Interval time.Duration // time since the previous sample (0 for the first)
+	CPUs     int           // number of CPUs in /proc/stat
+	Busy     float64       // % of all CPUs that were busy (not idle or waiting for IO)
+	Procs    []CPUSample   // one for each of the procs passed, in the same order
+	Exited   []uint64      // PIDs from the previous sample that have exited (or weren't passed), sorted
+}
+
+// CPUSampler computes CPU usage over intervals from successive snapshots of
+// processes, like top(1) rather than the lifetime average ps(1) shows.
+type CPUSampler struct {
+	// Cumulative adds the time of reaped children (Cutime and Cstime) to their
+	// parent, like 'top -S'.
+	Cumulative bool
+
+	mu     sync.Mutex
+	cfg    procConfig
+	hz     uint64
+	sample *cpuSnapshot
+}
+
+type cpuTimes struct {
+	start  uint64 // Start_time, to detect PID reuse
+	user   uint64
+	system uint64
+}
+
+type cpuSnapshot struct {
+	uptime float64 // from /proc/uptime, to detect processes started since
+	total  uint64  // jiffies of all CPUs
+	idle   uint64  // idle + iowait jiffies of all CPUs
+	cpus   int
+	procs  map[uint64]cpuTimes
+}
+
+// readCPUTotals returns the total and idle jiffies and the number of CPUs
+// from /proc/stat.
+func readCPUTotals(cfg *procConfig) (uint64, uint64, int, error) {
+	var total, idle uint64
+	var cpus int
+	var found bool
+
+	lines, err := readSystemLines(cfg, "stat")
+	if err != nil {
+		return 0, 0, 0, wrapError(err)
+	}
+
+	for n, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal guest guest_nice,
+		// guest time is already included in user and nice
+		if len(fields) < 5 {
+			return 0, 0, 0, parseError("stat", n+1, "cpu", fmt.Errorf("unexpected format: '%s'", line))
+		}
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			val, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return 0, 0, 0, parseError("stat", n+1, "cpu", err)
+			}
+			total += val
+			if i == 4 || i == 5 {
+				idle += val
+			}
+		}
+		found = true
+	}
+	if !found {
+		return 0, 0, 0, parseError("stat", 0, "cpu", errors.New("no 'cpu' line"))
+	}
+
+	return total, idle, cpus, nil
+}
+
+func readUptime(cfg *procConfig) (float64, error) {
+	var uptime float64
+
+	lines, err := readSystemLines(cfg, "uptime")
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	if len(lines) == 0 {
+		return 0, parseError("uptime", 0, "", errors.New("empty"))
+	}
+	_, err = fmt.Sscanf(lines[0], "%f", &uptime)
+	if err != nil {
+		return 0, parseError("uptime", 1, "", fmt.Errorf("bad uptime '%s': %v", lines[0], err))
+	}
+
+	return uptime, nil
+}
+
+func newCPUSampler(cfg *procConfig) (*CPUSampler, error) {
+	var s CPUSampler
+	var err error
+
+	s.cfg = *cfg
+	s.hz, err = readClockTicks(&s.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return &s, nil
+}
+
+// This function returns a CPUSampler for the processes in /proc. Call Sample()
+// with freshly read processes at each interval.
+func NewCPUSampler() (*CPUSampler, error) {
+	return defaultReader.NewCPUSampler()
+}
+
+// NewCPUSampler returns a CPUSampler for the processes in r.
+func (r *Reader) NewCPUSampler() (*CPUSampler, error) {
+	// no caching, /proc/stat and /proc/uptime need to be read each time
+	cfg := r.config()
+
+	return newCPUSampler(&cfg)
+}
+
+func (s *CPUSampler) times(proc *Proc) cpuTimes {
+	t := cpuTimes{start: proc.Stat.Start_time, user: proc.Stat.Utime, system: proc.Stat.Stime}
+	if s.Cumulative {
+		t.user += proc.Stat.Cutime
+		t.system += proc.Stat.Cstime
+	}
+	return t
+}
+
+// Sample records procs (which should have just been read) and returns their
+// CPU usage since the previous call. Processes which weren't passed to the
+// previous call are counted from when they started if that was during the
+// interval, otherwise they're marked Unknown. If a PID's Start_time changed,
+// the old process exited and the PID was reused, so it's in Exited and the
+// new process is Started. Sample is safe to call from multiple goroutines, but
+// the intervals will then be interleaved.
+func (s *CPUSampler) Sample(procs []Proc) (*CPUUsage, error) {
+	var usage CPUUsage
+	var snap cpuSnapshot
+	var err error
+
+	snap.total, snap.idle, snap.cpus, err = readCPUTotals(&s.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	snap.uptime, err = readUptime(&s.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	snap.procs = make(map[uint64]cpuTimes, len(procs))
+	for i := range procs {
+		snap.procs[procs[i].Stat.Pid] = s.times(&procs[i])
+	}
+
+	s.mu.Lock()
+	prev := s.sample
+	s.sample = &snap
+	s.mu.Unlock()
+
+	usage.CPUs = snap.cpus
+	usage.Procs = make([]CPUSample, len(procs))
+
+	// jiffies in the interval for one CPU
+	var interval float64
+	if prev != nil && snap.total > prev.total && snap.cpus > 0 {
+		delta := snap.total - prev.total
+		interval = float64(delta) / float64(snap.cpus)
+		usage.Interval = ticksToDuration(delta/uint64(snap.cpus), s.hz)
+		if snap.idle >= prev.idle && snap.idle-prev.idle <= delta {
+			usage.Busy = float64(delta-(snap.idle-prev.idle)) * 100 / float64(delta)
+		}
+	}
+
+	for i := range procs {
+		sample := &usage.Procs[i]
+		now := snap.procs[procs[i].Stat.Pid]
+
+		sample.Pid = procs[i].Stat.Pid
+		if prev == nil {
+			sample.Unknown = true
+			continue
+		}
+
+		before, ok := prev.procs[sample.Pid]
+		if !ok || before.start != now.start {
+			if now.start < uint64(prev.uptime*float64(s.hz)) {
+				// it was around last time, we just weren't told about it
+				sample.Unknown = true
+				continue
+			}
+			// started since the last sample, so all of its time is new
+			sample.Started = true
+			before = cpuTimes{start: now.start}
+		}
+		if interval == 0 {
+			continue
+		}
+
+		// times can go backwards slightly when the kernel adjusts them
+		if now.user > before.user {
+			sample.User = float64(now.user-before.user) * 100 / interval
+		}
+		if now.system > before.system {
+			sample.System = float64(now.system-before.system) * 100 / interval
+		}
+		sample.Total = sample.User + sample.System
+	}
+
+	if prev != nil {
+		for pid, before := range prev.procs {
+			now, ok := snap.procs[pid]
+			if !ok || now.start != before.start {
+				usage.Exited = append(usage.Exited, pid)
+			}
+		}
+		sort.Slice(usage.Exited, func(i, j int) bool {
+			return usage.Exited[i] < usage.Exited[j]
+		})
+	}
+
+	return &usage, nil
+}
@@ -0,0 +1,121 @@
+package procreader
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func cpuProc(pid uint64, start uint64, utime uint64, stime uint64, cutime uint64) Proc {
+	var proc Proc
+
+	proc.Stat = Stat_t{Pid: pid, Start_time: start, Utime: utime, Stime: stime, Cutime: cutime}
+
+	return proc
+}
+
+func TestCPUSampler(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"/uptime": "100.00 150.00\n",
+		"/stat": "cpu  1000 0 500 8000 500 0 0 0 0 0\n" +
+			"cpu0 500 0 250 4000 250 0 0 0 0 0\n" +
+			"cpu1 500 0 250 4000 250 0 0 0 0 0\n" +
+			"btime 1425970000\n",
+	}
+
+	s, err := newCPUSampler(&cfg)
+	if err != nil {
+		t.Fatalf("newCPUSampler(): %v\n", err)
+	}
+
+	usage, err := s.Sample([]Proc{
+		cpuProc(10, 1000, 100, 50, 0),
+		cpuProc(11, 2000, 10, 0, 0),
+		cpuProc(12, 3000, 10, 0, 0),
+	})
+	if err != nil {
+		t.Fatalf("Sample(1): %v\n", err)
+	}
+	if usage.Interval != 0 || usage.CPUs != 2 || len(usage.Procs) != 3 || !usage.Procs[0].Unknown {
+		t.Errorf("Sample(1): unexpected %+v\n", usage)
+	} else {
+		fmt.Printf("ok Sample(1) has no interval\n")
+	}
+
+	// 2 seconds later, with 2 CPUs that's 400 jiffies of which 200 idle
+	cfg.contents["/uptime"] = "102.00 152.00\n"
+	cfg.contents["/stat"] = "cpu  1150 0 550 8100 600 0 0 0 0 0\n" +
+		"cpu0 575 0 275 4050 300 0 0 0 0 0\n" +
+		"cpu1 575 0 275 4050 300 0 0 0 0 0\n" +
+		"btime 1425970000\n"
+
+	usage, err = s.Sample([]Proc{
+		cpuProc(10, 1000, 200, 70, 100), // 50% user, 10% system
+		cpuProc(11, 10050, 20, 0, 0),    // PID reused since the last sample
+		cpuProc(13, 500, 1000, 0, 0),    // not passed last time
+		cpuProc(14, 10100, 40, 0, 0),    // new, 20% user
+	})
+	if err != nil {
+		t.Fatalf("Sample(2): %v\n", err)
+	}
+
+	expect := CPUUsage{
+		Interval: 2 * time.Second,
+		CPUs:     2,
+		Busy:     50,
+		Procs: []CPUSample{
+			{Pid: 10, User: 50, System: 10, Total: 60},
+			{Pid: 11, User: 10, Total: 10, Started: true},
+			{Pid: 13, Unknown: true},
+			{Pid: 14, User: 20, Total: 20, Started: true},
+		},
+		Exited: []uint64{11, 12},
+	}
+	if !reflect.DeepEqual(*usage, expect) {
+		t.Errorf("Sample(2):\nexpected %+v\ngot      %+v\n", expect, *usage)
+	} else {
+		fmt.Printf("ok Sample(2)\n")
+	}
+
+	// with reaped children counted, 10 gets another 100 jiffies of user time
+	cfg.contents["/uptime"] = "104.00 154.00\n"
+	cfg.contents["/stat"] = "cpu  1300 0 600 8200 700 0 0 0 0 0\n" +
+		"cpu0 650 0 300 4100 350 0 0 0 0 0\n" +
+		"cpu1 650 0 300 4100 350 0 0 0 0 0\n"
+	s.Cumulative = true
+	_, err = s.Sample([]Proc{cpuProc(10, 1000, 200, 70, 100)})
+	if err != nil {
+		t.Fatalf("Sample(3): %v\n", err)
+	}
+	cfg.contents["/uptime"] = "106.00 156.00\n"
+	cfg.contents["/stat"] = "cpu  1450 0 650 8300 800 0 0 0 0 0\n" +
+		"cpu0 725 0 325 4150 400 0 0 0 0 0\n" +
+		"cpu1 725 0 325 4150 400 0 0 0 0 0\n"
+	usage, err = s.Sample([]Proc{cpuProc(10, 1000, 200, 70, 200)})
+	if err != nil {
+		t.Fatalf("Sample(4): %v\n", err)
+	}
+	if usage.Procs[0].User != 50 || len(usage.Exited) != 0 {
+		t.Errorf("Sample(4): expected 50%% user from children, got %+v\n", usage)
+	} else {
+		fmt.Printf("ok Sample(4) cumulative\n")
+	}
+}
+
+func TestReadCPUTotals(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{"/stat": "intr 0\nbtime 1425970000\n"}
+
+	_, _, _, err := readCPUTotals(&cfg)
+	if err == nil {
+		t.Errorf("readCPUTotals(): expected error without a cpu line\n")
+		return
+	}
+	fmt.Printf("ok readCPUTotals() failed: %v\n", err)
+}
@@ -0,0 +1,300 @@
+// Package dockertop converts procreader.Procs into the process information
+// used by 'docker top', either as the typed DockerTop described in
+//
+// https://github.com/docker/docker/pull/9232
+//
+// or as the ps(1) compatible titles and rows the docker API returns, so that
+// container runtimes can implement top without forking ps.
+package dockertop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joshwilsdon/procreader"
+)
+
+type DockerTop struct {
+	C           uint64   // integer %CPU, capped at 99
+	Comm        string   // executable name
+	Command     string   // full command line ("[comm]" if there isn't one)
+	Cputime     float64  // seconds of user + system CPU time
+	Gid         uint64   // effective GID
+	Group       string   // effective group name
+	Lwp         uint64   // thread ID (same as Pid as we only look at processes)
+	Nice        int32    // nice level
+	Pcpu        float32  // percentage of CPU used over the life of the process
+	Pid         uint64   // process ID
+	Pgid        int64    // process group ID
+	Pmem        float32  // resident set size as a percentage of total memory
+	Ppid        int64    // parent process ID
+	Psr         uint64   // CPU the process last ran on
+	Rgid        uint64   // real GID
+	Rgroup      string   // real group name
+	Rss         uint64   // resident set size (kB)
+	Ruid        uint64   // real UID
+	Ruser       string   // real user name
+	Start_time  float64  // when the process started (seconds since the epoch)
+	State       string   // "running", "sleeping", ...
+	State_flags []string // 'ps -o stat' flags: "low", "high", "lock", "leader", "threads", "foreground"
+	Tty         string   // controlling terminal, eg. "pts/0" ("?" if none)
+	Uid         uint64   // effective UID
+	User        string   // effective user name
+	Vsz         uint64   // virtual memory size (kB)
+}
+
+// Top is the body of a docker top response.
+type Top struct {
+	Titles    []string
+	Processes [][]string
+}
+
+// Converter holds what's needed to convert processes: the system wide values
+// (uptime, memory, ...) from a procreader.PsFormatter, and how to find the
+// users and groups for a process.
+type Converter struct {
+	Formatter *procreader.PsFormatter
+
+	// Resolver returns the Resolver for the process' users and groups. The
+	// default (from New()) uses the process' own root so names are those of
+	// its container, see procreader.ProcResolvers. Where it returns nil (eg.
+	// for other users' processes without privileges) or is nil,
+	// Formatter.Resolver is used, which is the host's (or the sysroot's) users
+	// and groups.
+	Resolver func(proc *procreader.Proc) *procreader.Resolver
+}
+
+// ps options docker users commonly pass, as 'ps -o' specs
+var psFormats = map[string][]string{
+	"":     {"pid", "tname", "time", "ucmd"},
+	"-e":   {"pid", "tname", "time", "ucmd"},
+	"-f":   {"user=UID", "pid,ppid,c,stime", "tname", "time", "cmd"},
+	"-ef":  {"user=UID", "pid,ppid,c,stime", "tname", "time", "cmd"},
+	"aux":  {"user,pid,%cpu,%mem,vsz,rss", "tname", "stat,start_time,bsdtime,args"},
+	"-aux": {"user,pid,%cpu,%mem,vsz,rss", "tname", "stat,start_time,bsdtime,args"},
+}
+
+var states = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "uninterruptible",
+	"Z": "zombie",
+	"T": "stopped",
+	"t": "tracing stop",
+	"X": "dead",
+	"I": "idle",
+}
+
+// This function returns a Converter using the current system values and
+// resolving names through each process' /proc/<pid>/root.
+func New() (*Converter, error) {
+	return NewWithReader(procreader.New())
+}
+
+// This function returns a Converter for the processes read by r, eg. one
+// created with procreader.WithRoot("/host/proc") in a monitoring container.
+func NewWithReader(r *procreader.Reader) (*Converter, error) {
+	var c Converter
+	var err error
+
+	c.Formatter, err = r.NewPsFormatter("pid")
+	if err != nil {
+		return nil, err
+	}
+	c.Resolver = r.NewProcResolvers().Resolver
+
+	return &c, nil
+}
+
+// resolver returns the Resolver for proc's users and groups, or nil to show
+// the IDs.
+func (c *Converter) resolver(proc *procreader.Proc) *procreader.Resolver {
+	if c.Resolver != nil {
+		if resolver := c.Resolver(proc); resolver != nil {
+			return resolver
+		}
+	}
+	return c.Formatter.Resolver
+}
+
+// userName is resolver.UserName(uid), or uid when there's no resolver.
+func userName(resolver *procreader.Resolver, uid uint64) (string, error) {
+	if resolver == nil {
+		return strconv.FormatUint(uid, 10), nil
+	}
+	return resolver.UserName(uid)
+}
+
+// groupName is resolver.GroupName(gid), or gid when there's no resolver.
+func groupName(resolver *procreader.Resolver, gid uint64) (string, error) {
+	if resolver == nil {
+		return strconv.FormatUint(gid, 10), nil
+	}
+	return resolver.GroupName(gid)
+}
+
+// https://gitorious.org/procps/procps/source/3a66fba1e934cbd830df572d8d03c05b4f4a5f1e:ps/output.c#L775-794
+func stateFlags(proc *procreader.Proc) []string {
+	var result []string
+
+	if proc.Stat.Nice > 0 {
+		// N flag in 'ps -o stat'
+		result = append(result, "low")
+	}
+
+	if proc.Stat.Nice < 0 {
+		// < flag in 'ps -o stat'
+		result = append(result, "high")
+	}
+
+	if proc.Status.VmLck > 0 {
+		// L flag in 'ps -o stat'
+		result = append(result, "lock")
+	}
+
+	if int64(proc.Stat.Pid) == proc.Stat.Sid {
+		// s flag in 'ps -o stat'
+		result = append(result, "leader")
+	}
+
+	if proc.Stat.Num_threads > 1 {
+		// l flag in 'ps -o stat'
+		result = append(result, "threads")
+	}
+
+	if proc.Stat.Tty_pgrp != -1 && proc.Stat.Pgrp == proc.Stat.Tty_pgrp {
+		// + flag in 'ps -o stat'
+		result = append(result, "foreground")
+	}
+
+	return result
+}
+
+// Convert returns the DockerTop for proc.
+func (c *Converter) Convert(proc *procreader.Proc) (DockerTop, error) {
+	var dt DockerTop
+	var err error
+
+	f := c.Formatter
+	resolver := c.resolver(proc)
+
+	dt.Pcpu = float32(f.Pcpu(proc))
+	dt.C = uint64(dt.Pcpu)
+	if dt.C > 99 {
+		dt.C = 99
+	}
+	dt.Comm = proc.Stat.Tcomm
+	dt.Command = "[" + proc.Stat.Tcomm + "]"
+	if len(proc.Cmdline) > 0 {
+		dt.Command = strings.Join(proc.Cmdline, " ")
+	}
+	dt.Cputime = float64(proc.Stat.Utime+proc.Stat.Stime) / float64(f.Hertz)
+	dt.Gid = proc.Status.Gid.Effective
+	dt.Group, err = groupName(resolver, dt.Gid)
+	if err != nil {
+		return dt, err
+	}
+	dt.Lwp = proc.Stat.Pid
+	dt.Nice = proc.Stat.Nice
+	dt.Pid = proc.Stat.Pid
+	dt.Pgid = proc.Stat.Pgrp
+	dt.Pmem = float32(f.Pmem(proc))
+	dt.Ppid = proc.Stat.Ppid
+	dt.Psr = proc.Stat.Task_cpu
+	dt.Rgid = proc.Status.Gid.Real
+	dt.Rgroup, err = groupName(resolver, dt.Rgid)
+	if err != nil {
+		return dt, err
+	}
+	dt.Rss = proc.Stat.Rss * f.PageSize / 1024
+	dt.Ruid = proc.Status.Uid.Real
+	dt.Ruser, err = userName(resolver, dt.Ruid)
+	if err != nil {
+		return dt, err
+	}
+	dt.Start_time = float64(f.StartTime(proc).UnixNano()) / 1e9
+	dt.State = states[proc.Stat.State]
+	if dt.State == "" {
+		dt.State = "unknown"
+	}
+	dt.State_flags = stateFlags(proc)
+	dt.Tty, err = f.TtyName(proc)
+	if err != nil {
+		return dt, err
+	}
+	dt.Uid = proc.Status.Uid.Effective
+	dt.User, err = userName(resolver, dt.Uid)
+	if err != nil {
+		return dt, err
+	}
+	dt.Vsz = proc.Stat.Vsize / 1024
+
+	return dt, nil
+}
+
+// This function returns procs formatted like the output of 'ps <psArgs>'.
+// psArgs can be one of "" (plain ps), "-e", "-f", "-ef", "aux" or "-aux"
+// (column compatible with procps), or "-o <columns>" with any of the columns
+// supported by procreader.ParsePsColumns(). Options which select processes are
+// ignored, as docker passes the processes in the container.
+func (c *Converter) Top(procs []procreader.Proc, psArgs string) (Top, error) {
+	var top Top
+	var err error
+
+	specs, ok := psFormats[strings.TrimSpace(psArgs)]
+	if !ok {
+		specs, err = parsePsArgs(psArgs)
+		if err != nil {
+			return top, err
+		}
+	}
+
+	f := *c.Formatter
+	f.Columns, err = procreader.ParsePsColumns(specs...)
+	if err != nil {
+		return top, err
+	}
+
+	top.Titles = f.Titles()
+	for i := range procs {
+		// user names come from the process' container
+		f.Resolver = c.resolver(&procs[i])
+		row, err := f.Row(&procs[i])
+		if err != nil {
+			return top, err
+		}
+		top.Processes = append(top.Processes, row)
+	}
+
+	return top, nil
+}
+
+// parsePsArgs returns the -o arguments from a ps command line such as
+// "-o pid,comm -o args=COMMAND" (selection options like -e or -A are skipped).
+func parsePsArgs(psArgs string) ([]string, error) {
+	var specs []string
+
+	args := strings.Fields(psArgs)
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-o" || args[i] == "o" || args[i] == "--format":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("dockertop: missing argument to %s", args[i])
+			}
+			i++
+			specs = append(specs, args[i])
+		case strings.HasPrefix(args[i], "-o"):
+			specs = append(specs, args[i][2:])
+		case args[i] == "-e" || args[i] == "-A" || args[i] == "ax" || args[i] == "-ax":
+			continue
+		default:
+			return nil, fmt.Errorf("dockertop: unsupported ps option '%s'", args[i])
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("dockertop: no columns in '%s'", psArgs)
+	}
+
+	return specs, nil
+}
@@ -0,0 +1,235 @@
+package dockertop
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/joshwilsdon/procreader"
+)
+
+// testReader returns a Reader for a fixed system, booted 10000 seconds before
+// 12:00 on 2015-03-10 with 1GB of memory, whose root filesystem has
+// /dev/pts/0 and testdata/etc/{passwd,group}.
+func testReader(t *testing.T) *procreader.Reader {
+	proc := fstest.MapFS{
+		"uptime":      {Data: []byte("10000.00 39000.00\n")},
+		"stat":        {Data: []byte("cpu  100 0 100 1000 0 0 0 0 0 0\nbtime 1425978800\n")},
+		"meminfo":     {Data: []byte("MemTotal:        1000000 kB\n")},
+		"tty/drivers": {Data: []byte("pty_slave /dev/pts 136 0-1048575 pty:slave\n")},
+	}
+	root := fstest.MapFS{
+		"dev/pts/0": {Mode: fs.ModeDevice | fs.ModeCharDevice | 0620, Sys: &syscall.Stat_t{Rdev: 136 << 8}},
+	}
+	for _, name := range []string{"etc/passwd", "etc/group"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v\n", name, err)
+		}
+		root[name] = &fstest.MapFile{Data: data}
+	}
+
+	return procreader.NewReader(proc, procreader.WithSysRootFS(root))
+}
+
+// testFormatter is testReader()'s PsFormatter at 12:00 with 4k pages.
+func testFormatter(t *testing.T, r *procreader.Reader) *procreader.PsFormatter {
+	f, err := r.NewPsFormatter("pid")
+	if err != nil {
+		t.Fatalf("NewPsFormatter(): %v\n", err)
+	}
+	f.PageSize = 4096
+	f.Now = time.Date(2015, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	return f
+}
+
+func testConverter(t *testing.T) *Converter {
+	var c Converter
+
+	// the sysroot's users and groups stand in for the container's
+	c.Formatter = testFormatter(t, testReader(t))
+	c.Resolver = func(proc *procreader.Proc) *procreader.Resolver {
+		return c.Formatter.Resolver
+	}
+
+	return &c
+}
+
+// testProcs returns the processes of an nginx container (started by a
+// containerd-shim with PID 900 outside the container) with a 'docker exec'd
+// shell.
+func testProcs() []procreader.Proc {
+	var tini, master, worker, shell procreader.Proc
+
+	tini.Stat = procreader.Stat_t{Pid: 1000, Tcomm: "tini", State: "S", Ppid: 900,
+		Pgrp: 1000, Sid: 1000, Tty_pgrp: -1, Utime: 100, Stime: 100, Priority: 20,
+		Num_threads: 1, Start_time: 500000, Vsize: 2048 * 1024, Rss: 100}
+	tini.Status.VmRSS = 400
+	tini.Cmdline = []string{"/tini", "--", "nginx", "-g", "daemon off;"}
+
+	master.Stat = procreader.Stat_t{Pid: 1001, Tcomm: "nginx", State: "S", Ppid: 1000,
+		Pgrp: 1000, Sid: 1000, Tty_pgrp: -1, Utime: 40000, Stime: 9990, Priority: 15,
+		Nice: -5, Num_threads: 1, Start_time: 500100, Task_cpu: 1,
+		Vsize: 10240 * 1024, Rss: 1000}
+	master.Status.VmRSS = 4000
+	master.Status.VmLck = 4
+	master.Cmdline = []string{"nginx: master process nginx -g daemon off;"}
+
+	worker.Stat = procreader.Stat_t{Pid: 1002, Tcomm: "nginx", State: "S", Ppid: 1001,
+		Pgrp: 1000, Sid: 1000, Tty_pgrp: -1, Priority: 20, Num_threads: 2,
+		Start_time: 500100, Vsize: 10240 * 1024, Rss: 500}
+	worker.Status.VmRSS = 2000
+	worker.Status.Uid = procreader.Ids{Real: 33, Effective: 33, Saved: 33, FS: 33}
+	worker.Status.Gid = procreader.Ids{Real: 33, Effective: 33, Saved: 33, FS: 33}
+	worker.Cmdline = []string{"nginx: worker process"}
+
+	shell.Stat = procreader.Stat_t{Pid: 1004, Tcomm: "sh", State: "R", Ppid: 900,
+		Pgrp: 1004, Sid: 1004, Tty_nr: 136 << 8, Tty_pgrp: 1004, Priority: 20,
+		Num_threads: 1, Start_time: 990000, Vsize: 4096 * 1024, Rss: 500}
+	shell.Status.VmRSS = 2000
+	shell.Status.Uid = procreader.Ids{Real: 101, Effective: 101, Saved: 101, FS: 101}
+	shell.Status.Gid = procreader.Ids{Real: 101, Effective: 101, Saved: 101, FS: 101}
+	shell.Cmdline = []string{"/bin/sh"}
+
+	return []procreader.Proc{tini, master, worker, shell}
+}
+
+func TestConvert(t *testing.T) {
+	c := testConverter(t)
+	procs := testProcs()
+
+	var tests = []DockerTop{
+		{C: 10, Comm: "nginx", Command: "nginx: master process nginx -g daemon off;",
+			Cputime: 499.9, Group: "root", Lwp: 1001, Nice: -5, Pcpu: 10, Pid: 1001,
+			Pgid: 1000, Pmem: 0.4, Ppid: 1000, Psr: 1, Rgroup: "root", Rss: 4000,
+			Ruser: "root", Start_time: 1425983801, State: "sleeping",
+			State_flags: []string{"high", "lock"}, Tty: "?", User: "root", Vsz: 10240},
+		{Comm: "nginx", Command: "nginx: worker process", Gid: 33, Group: "www-data",
+			Lwp: 1002, Pid: 1002, Pgid: 1000, Pmem: 0.2, Ppid: 1001, Rgid: 33,
+			Rgroup: "www-data", Rss: 2000, Ruid: 33, Ruser: "www-data",
+			Start_time: 1425983801, State: "sleeping", State_flags: []string{"threads"},
+			Tty: "?", Uid: 33, User: "www-data", Vsz: 10240},
+		{Comm: "sh", Command: "/bin/sh", Gid: 101, Group: "nginx", Lwp: 1004,
+			Pid: 1004, Pgid: 1004, Pmem: 0.2, Ppid: 900, Rgid: 101, Rgroup: "nginx",
+			Rss: 2000, Ruid: 101, Ruser: "nginx", Start_time: 1425988700,
+			State: "running", State_flags: []string{"leader", "foreground"},
+			Tty: "pts/0", Uid: 101, User: "nginx", Vsz: 4096},
+	}
+
+	for i, expect := range tests {
+		dt, err := c.Convert(&procs[i+1])
+		if err != nil {
+			t.Errorf("Convert(%d): %v\n", expect.Pid, err)
+			continue
+		}
+		if !reflect.DeepEqual(dt, expect) {
+			t.Errorf("Convert(%d):\nexpected %#v\ngot      %#v\n", expect.Pid, expect, dt)
+			continue
+		}
+		fmt.Printf("ok Convert(%d)\n", expect.Pid)
+	}
+}
+
+func TestTop(t *testing.T) {
+	c := testConverter(t)
+
+	var tests = []struct {
+		psArgs string
+		expect Top
+	}{
+		{"-ef", Top{
+			Titles: []string{"UID", "PID", "PPID", "C", "STIME", "TTY", "TIME", "CMD"},
+			Processes: [][]string{
+				{"root", "1000", "900", "0", "10:36", "?", "00:00:02", "/tini -- nginx -g daemon off;"},
+				{"root", "1001", "1000", "10", "10:36", "?", "00:08:19", "nginx: master process nginx -g daemon off;"},
+				{"www-data", "1002", "1001", "0", "10:36", "?", "00:00:00", "nginx: worker process"},
+				{"nginx", "1004", "900", "0", "11:58", "pts/0", "00:00:00", "/bin/sh"},
+			}}},
+		{"aux", Top{
+			Titles: []string{"USER", "PID", "%CPU", "%MEM", "VSZ", "RSS", "TTY", "STAT", "START", "TIME", "COMMAND"},
+			Processes: [][]string{
+				{"root", "1000", "0.0", "0.0", "2048", "400", "?", "Ss", "10:36", "0:02", "/tini -- nginx -g daemon off;"},
+				{"root", "1001", "10.0", "0.4", "10240", "4000", "?", "S<L", "10:36", "8:19", "nginx: master process nginx -g daemon off;"},
+				{"www-data", "1002", "0.0", "0.2", "10240", "2000", "?", "Sl", "10:36", "0:00", "nginx: worker process"},
+				{"nginx", "1004", "0.0", "0.2", "4096", "2000", "pts/0", "Rs+", "11:58", "0:00", "/bin/sh"},
+			}}},
+		{"-e -o pid,comm -o args=CMDLINE", Top{
+			Titles: []string{"PID", "COMMAND", "CMDLINE"},
+			Processes: [][]string{
+				{"1000", "tini", "/tini -- nginx -g daemon off;"},
+				{"1001", "nginx", "nginx: master process nginx -g daemon off;"},
+				{"1002", "nginx", "nginx: worker process"},
+				{"1004", "sh", "/bin/sh"},
+			}}},
+	}
+
+	for _, test := range tests {
+		top, err := c.Top(testProcs(), test.psArgs)
+		if err != nil {
+			t.Errorf("Top(%s): %v\n", test.psArgs, err)
+			continue
+		}
+		if !reflect.DeepEqual(top, test.expect) {
+			t.Errorf("Top(%s):\nexpected %q\ngot      %q\n", test.psArgs, test.expect, top)
+			continue
+		}
+		fmt.Printf("ok Top(%s)\n", test.psArgs)
+	}
+
+	for _, psArgs := range []string{"-Z", "-o", "-e -o"} {
+		_, err := c.Top(testProcs(), psArgs)
+		if err == nil {
+			t.Errorf("Top(%s): expected error\n", psArgs)
+			continue
+		}
+		fmt.Printf("ok Top(%s) failed: %v\n", psArgs, err)
+	}
+}
+
+func TestConverterDefaults(t *testing.T) {
+	// without a Resolver, the names come from the formatter's sysroot
+	f := testFormatter(t, testReader(t))
+	c := Converter{Formatter: f}
+	procs := testProcs()
+
+	dt, err := c.Convert(&procs[3])
+	if err != nil || dt.User != "nginx" || dt.Group != "nginx" {
+		t.Errorf("Convert(1004): expected nginx/nginx, got '%s'/'%s' (%v)\n", dt.User, dt.Group, err)
+	} else {
+		fmt.Printf("ok Convert() without a Resolver\n")
+	}
+
+	top, err := c.Top(procs, "-o user,pid")
+	if err != nil || top.Processes[2][0] != "www-data" {
+		t.Errorf("Top(): expected www-data, got %q (%v)\n", top.Processes, err)
+	} else {
+		fmt.Printf("ok Top() without a Resolver\n")
+	}
+
+	// or where it has none
+	c.Resolver = func(proc *procreader.Proc) *procreader.Resolver {
+		return nil
+	}
+	dt, err = c.Convert(&procs[3])
+	if err != nil || dt.User != "nginx" || dt.Group != "nginx" {
+		t.Errorf("Convert(1004): expected nginx/nginx, got '%s'/'%s' (%v)\n", dt.User, dt.Group, err)
+	} else {
+		fmt.Printf("ok Convert() with a nil Resolver\n")
+	}
+
+	// and without either, the IDs
+	f.Resolver = nil
+	dt, err = c.Convert(&procs[3])
+	if err != nil || dt.User != "101" || dt.Rgroup != "101" {
+		t.Errorf("Convert(1004): expected 101/101, got '%s'/'%s' (%v)\n", dt.User, dt.Rgroup, err)
+	} else {
+		fmt.Printf("ok Convert() without any resolver\n")
+	}
+}
@@ -0,0 +1,95 @@
+//
+// Eg. 'go run examples/proc_pstree.go -p -u 1'
+//
+// Usage: <proc_pstree.go> [-a] [-c] [-n] [-p] [-u] [-A|-U] [-T] [pid]
+//
+// prints the process tree like pstree(1), starting at the specified process
+// (or showing all trees if no pid is given).
+//
+
+package main
+
+import (
+	"../../procreader"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func main() {
+
+	var err error
+	var opts procreader.TreeOptions
+	var procs []procreader.Proc
+
+	flag.BoolVar(&opts.Args, "a", false, "show command line arguments")
+	flag.BoolVar(&opts.NoCompact, "c", false, "don't compact identical subtrees")
+	flag.BoolVar(&opts.SortByPid, "n", false, "sort processes by PID instead of name")
+	flag.BoolVar(&opts.ShowPids, "p", false, "show PIDs")
+	flag.BoolVar(&opts.ShowUids, "u", false, "show UID transitions")
+	flag.BoolVar(&opts.HideThreads, "T", false, "hide threads")
+	ascii := flag.Bool("A", false, "use ASCII line drawing characters")
+	unicode := flag.Bool("U", false, "use Unicode line drawing characters")
+	flag.Parse()
+
+	opts.Unicode = *unicode && !*ascii
+
+	/* only read what the tree needs: uids for -u and arguments for -a */
+	fields := procreader.Stat
+	if opts.ShowUids {
+		fields |= procreader.Status
+	}
+	if opts.Args {
+		fields |= procreader.Cmdline
+	}
+
+	pids, err := procreader.ListPids()
+	if err != nil {
+		panic(err)
+	}
+	for _, pid := range pids {
+		proc, err := procreader.ReadProc(pid, procreader.Fields(fields))
+		if errors.Is(err, procreader.ErrProcessGone) {
+			/* exited since we listed it */
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %d: %v\n", pid, err)
+			continue
+		}
+		procs = append(procs, proc)
+	}
+
+	tree := procreader.BuildTree(procs)
+	roots := tree.Roots
+
+	if flag.NArg() > 0 {
+		pid, err := strconv.ParseUint(flag.Arg(0), 10, 64)
+		if err != nil {
+			fmt.Printf("'%s' is not an integer\n", flag.Arg(0))
+			os.Exit(1)
+		}
+		node := tree.Find(pid)
+		if node == nil {
+			fmt.Printf("process %d not found\n", pid)
+			os.Exit(1)
+		}
+		roots = []*procreader.ProcNode{node}
+	}
+
+	if opts.ShowUids {
+		/*
+		 * Use the names from each process' root, so those in containers get
+		 * theirs. Those we can't look in get the host's.
+		 */
+		opts.Resolver = procreader.NewResolver("/")
+		opts.ProcResolver = procreader.NewProcResolvers().Resolver
+	}
+
+	err = procreader.RenderTree(os.Stdout, roots, opts)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -55,15 +55,15 @@ func main() {
 		// Apparently we also can't easily get the current package from within that
 		// package so we do this instead.
 		//
-		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\t%#v,\n", proc.Stat),
+		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\tStat: %#v,\n", proc.Stat),
 			"procreader.", "", -1))
-		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\t%#v,\n", proc.Statm),
+		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\tStatm: %#v,\n", proc.Statm),
 			"procreader.", "", -1))
-		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\t%#v,\n", proc.Status),
+		fmt.Printf("%s", strings.Replace(fmt.Sprintf("\t\t\tStatus: %#v,\n", proc.Status),
 			"procreader.", "", -1))
 
-		fmt.Printf("\t\t\t%#v,\n", proc.Cmdline)
-		fmt.Printf("\t\t\t%#v,\n", proc.Environ)
+		fmt.Printf("\t\t\tCmdline: %#v,\n", proc.Cmdline)
+		fmt.Printf("\t\t\tEnviron: %#v,\n", proc.Environ)
 		fmt.Printf("\t\t},\n")
 		fmt.Printf("\t},\n")
 	}
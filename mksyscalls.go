@@ -0,0 +1,169 @@
+//go:build ignore
+
+// Eg. 'go run mksyscalls.go x86_64=/usr/include/asm/unistd_64.h ... > zsyscalls.go'
+//
+// Usage: <mksyscalls.go> <arch>=<unistd.h> [...]
+//
+// Generates the syscall number to name tables used by SyscallName(). Each
+// argument names one of the architectures from syscall.go and a header (or
+// 'gcc -E -dM' output for asm-generic/unistd.h) containing its
+// '#define __NR_<name> <number>' lines. Defines that refer to other __NR_
+// values (eg. '__NR_fcntl __NR3264_fcntl' or '(__NR_arch_specific_syscall + 15)')
+// are resolved.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type syscallEntry struct {
+	nr   uint64
+	name string
+}
+
+// these are markers in the headers, not syscalls
+var skipNames = map[string]bool{
+	"syscalls":              true,
+	"arch_specific_syscall": true,
+	"Linux":                 true,
+}
+
+func resolve(defines map[string]string, expr string, depth int) (uint64, error) {
+	if depth > 8 {
+		return 0, fmt.Errorf("too many levels resolving '%s'", expr)
+	}
+
+	expr = strings.TrimSpace(strings.Trim(strings.TrimSpace(expr), "()"))
+
+	if idx := strings.Index(expr, "+"); idx != -1 {
+		a, err := resolve(defines, expr[:idx], depth+1)
+		if err != nil {
+			return 0, err
+		}
+		b, err := resolve(defines, expr[idx+1:], depth+1)
+		if err != nil {
+			return 0, err
+		}
+		return a + b, nil
+	}
+
+	if n, err := strconv.ParseUint(expr, 0, 64); err == nil {
+		return n, nil
+	}
+
+	if val, ok := defines[expr]; ok {
+		return resolve(defines, val, depth+1)
+	}
+
+	return 0, fmt.Errorf("cannot resolve '%s'", expr)
+}
+
+func readHeader(filename string) ([]syscallEntry, error) {
+	var entries []syscallEntry
+	var names []string
+	var defines = make(map[string]string)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 3)
+		if len(fields) != 3 || fields[0] != "#define" {
+			continue
+		}
+		if !strings.HasPrefix(fields[1], "__NR") {
+			continue
+		}
+		defines[fields[1]] = fields[2]
+		if strings.HasPrefix(fields[1], "__NR_") {
+			names = append(names, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, define := range names {
+		name := strings.TrimPrefix(define, "__NR_")
+		if skipNames[name] {
+			continue
+		}
+		nr, err := resolve(defines, defines[define], 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, define, err)
+		}
+		entries = append(entries, syscallEntry{nr: nr, name: name})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].nr < entries[j].nr
+	})
+
+	for i := 1; i < len(entries); i++ {
+		if entries[i].nr == entries[i-1].nr {
+			return nil, fmt.Errorf("%s: %s and %s are both %d", filename,
+				entries[i-1].name, entries[i].name, entries[i].nr)
+		}
+	}
+
+	return entries, nil
+}
+
+func main() {
+	var args []string
+	var buf bytes.Buffer
+
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s <arch>=<unistd.h> [...]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	fmt.Fprintf(&buf, "// go run mksyscalls.go")
+	for _, arg := range os.Args[1:] {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "'%s' is not <arch>=<unistd.h>\n", arg)
+			os.Exit(2)
+		}
+		fmt.Fprintf(&buf, " %s=...", parts[0])
+		args = append(args, arg)
+	}
+	fmt.Fprintf(&buf, "\n// Code generated by the command above; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package procreader\n")
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+
+		entries, err := readHeader(parts[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(&buf, "\nvar syscalls_%s = map[uint64]string{\n", parts[0])
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "\t%d: %q,\n", e.nr, e.name)
+		}
+		fmt.Fprintf(&buf, "}\n")
+	}
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
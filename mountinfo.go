@@ -0,0 +1,170 @@
+package procreader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Fields from https://www.kernel.org/doc/Documentation/filesystems/proc.txt
+ * (section 3.5 /proc/<pid>/mountinfo)
+ */
+
+type MountInfo_t struct {
+	// fields from a line of /proc/<pid>/mountinfo
+
+	Mount_id        uint64   // unique identifier of the mount (may be reused after umount)
+	Parent_id       uint64   // ID of parent (or of self for the top of the mount tree)
+	Major           uint32   // major of st_dev for files on this filesystem
+	Minor           uint32   // minor of st_dev for files on this filesystem
+	Root            string   // root of the mount within the filesystem
+	Mount_point     string   // mount point relative to the process's root
+	Mount_options   []string // per mount options
+	Optional_fields []string // zero or more fields of the form "tag[:value]"
+	Fstype          string   // name of filesystem of the form "type[.subtype]"
+	Mount_source    string   // filesystem specific information or "none"
+	Super_options   []string // per super block options
+
+	// these are parsed from Optional_fields
+	Shared         uint64 // peer group if the mount is shared (0 if not)
+	Master         uint64 // peer group the mount is a slave to (0 if not)
+	Propagate_from uint64 // nearest dominant peer group visible to the process (0 if none)
+	Unbindable     bool   // mount is unbindable
+}
+
+// unescapeOctal decodes the '\ooo' escapes the kernel uses in mountinfo (and
+// mounts) for space, tab, newline and backslash.
+func unescapeOctal(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			buf = append(buf, (s[i+1]-'0')<<6|(s[i+2]-'0')<<3|(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+
+	return string(buf)
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+func parseMountInfo(line string) (MountInfo_t, error) {
+	var mi MountInfo_t
+	var err error
+
+	fields := strings.Split(line, " ")
+
+	// optional fields are terminated by a single '-'
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 || len(fields) < sep+4 {
+		return mi, parseError("mountinfo", 0, "", fmt.Errorf("unexpected format: '%s'", line))
+	}
+
+	mi.Mount_id, err = strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return mi, parseError("mountinfo", 0, "Mount_id", err)
+	}
+	mi.Parent_id, err = strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return mi, parseError("mountinfo", 0, "Parent_id", err)
+	}
+
+	devs := strings.SplitN(fields[2], ":", 2)
+	if len(devs) != 2 {
+		return mi, parseError("mountinfo", 0, "Major", fmt.Errorf("bad major:minor '%s'", fields[2]))
+	}
+	major, err := strconv.ParseUint(devs[0], 10, 32)
+	if err != nil {
+		return mi, parseError("mountinfo", 0, "Major", err)
+	}
+	minor, err := strconv.ParseUint(devs[1], 10, 32)
+	if err != nil {
+		return mi, parseError("mountinfo", 0, "Minor", err)
+	}
+	mi.Major = uint32(major)
+	mi.Minor = uint32(minor)
+
+	mi.Root = unescapeOctal(fields[3])
+	mi.Mount_point = unescapeOctal(fields[4])
+	mi.Mount_options = strings.Split(fields[5], ",")
+
+	for _, opt := range fields[6:sep] {
+		mi.Optional_fields = append(mi.Optional_fields, opt)
+
+		tag := strings.SplitN(opt, ":", 2)
+		if tag[0] == "unbindable" {
+			mi.Unbindable = true
+			continue
+		}
+		if len(tag) != 2 {
+			continue
+		}
+		group, err := strconv.ParseUint(tag[1], 10, 64)
+		if err != nil {
+			return mi, parseError("mountinfo", 0, "Optional_fields", err)
+		}
+		switch tag[0] {
+		case "shared":
+			mi.Shared = group
+		case "master":
+			mi.Master = group
+		case "propagate_from":
+			mi.Propagate_from = group
+		}
+	}
+
+	mi.Fstype = unescapeOctal(fields[sep+1])
+	mi.Mount_source = unescapeOctal(fields[sep+2])
+	mi.Super_options = strings.Split(fields[sep+3], ",")
+
+	return mi, nil
+}
+
+func readMountInfo(cfg *procConfig, pid uint64) ([]MountInfo_t, error) {
+	var mounts []MountInfo_t
+
+	lines, err := readLines(cfg, pid, "mountinfo")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for n, line := range lines {
+		mi, err := parseMountInfo(line)
+		if err != nil {
+			return nil, withContext(atLine(err, n+1), pid, "mountinfo")
+		}
+		mounts = append(mounts, mi)
+	}
+
+	return mounts, nil
+}
+
+// This function reads /proc/<pid>/mountinfo and returns the mounts as seen from
+// the specified process' mount namespace, in the order the kernel lists them.
+func ReadMountInfo(pid uint64) ([]MountInfo_t, error) {
+	return defaultReader.ReadMountInfo(pid)
+}
+
+// ReadMountInfo is ReadMountInfo() for the proc filesystem in r.
+func (r *Reader) ReadMountInfo(pid uint64) ([]MountInfo_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	mounts, err := readMountInfo(&cfg, pid)
+	return mounts, pidError(&cfg, pid, err)
+}
@@ -0,0 +1,100 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadMountInfo(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"mountinfo": "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro\n" +
+			"36 22 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue\n" +
+			"41 22 0:36 /data/my\\040volume /var/lib/docker/volumes/x\\134y rw shared:5 master:2 propagate_from:3 - tmpfs tmp\\011fs rw\n" +
+			"42 22 0:37 / /priv ro,nosuid unbindable - proc proc rw\n",
+	}
+
+	expected := []MountInfo_t{
+		{
+			Mount_id: 22, Parent_id: 1, Major: 8, Minor: 1, Root: "/", Mount_point: "/",
+			Mount_options: []string{"rw", "relatime"}, Optional_fields: []string{"shared:1"},
+			Fstype: "ext4", Mount_source: "/dev/sda1", Super_options: []string{"rw", "errors=remount-ro"},
+			Shared: 1,
+		},
+		{
+			Mount_id: 36, Parent_id: 22, Major: 98, Minor: 0, Root: "/mnt1", Mount_point: "/mnt2",
+			Mount_options: []string{"rw", "noatime"}, Optional_fields: []string{"master:1"},
+			Fstype: "ext3", Mount_source: "/dev/root", Super_options: []string{"rw", "errors=continue"},
+			Master: 1,
+		},
+		{
+			Mount_id: 41, Parent_id: 22, Major: 0, Minor: 36, Root: "/data/my volume",
+			Mount_point: "/var/lib/docker/volumes/x\\y", Mount_options: []string{"rw"},
+			Optional_fields: []string{"shared:5", "master:2", "propagate_from:3"},
+			Fstype:          "tmpfs", Mount_source: "tmp\tfs", Super_options: []string{"rw"},
+			Shared: 5, Master: 2, Propagate_from: 3,
+		},
+		{
+			Mount_id: 42, Parent_id: 22, Major: 0, Minor: 37, Root: "/", Mount_point: "/priv",
+			Mount_options: []string{"ro", "nosuid"}, Optional_fields: []string{"unbindable"},
+			Fstype: "proc", Mount_source: "proc", Super_options: []string{"rw"},
+			Unbindable: true,
+		},
+	}
+
+	mounts, err := readMountInfo(&cfg, 1)
+	if err != nil {
+		t.Fatalf("readMountInfo: %s\n", err.Error())
+	}
+	if len(mounts) != len(expected) {
+		t.Fatalf("readMountInfo: expected %d mounts, got %d\n", len(expected), len(mounts))
+	}
+	for i := range mounts {
+		if !reflect.DeepEqual(mounts[i], expected[i]) {
+			t.Errorf("<%d> mountinfo: actual != expected: %#v\n", mounts[i].Mount_id, mounts[i])
+		} else {
+			fmt.Printf("ok <%d> mountinfo matches\n", mounts[i].Mount_id)
+		}
+	}
+
+	cfg.contents = map[string]string{"mountinfo": "22 1 8:1 / / rw shared:1 ext4 /dev/sda1 rw\n"}
+	if _, err := readMountInfo(&cfg, 1); !errors.Is(err, ErrParse) {
+		t.Errorf("readMountInfo: expected missing separator to be ErrParse, got %v\n", err)
+	}
+}
+
+func TestReadMountInfoErrors(t *testing.T) {
+	r := NewReader(fstest.MapFS{
+		"7/mountinfo": {Data: []byte("22 1 8:1 / / rw - ext4 /dev/sda1 rw\nx 1 8:1 / / rw - ext4 /dev/sda1 rw\n")},
+		"8":           {Mode: os.ModeDir},
+	})
+
+	_, err := r.ReadMountInfo(7)
+	var perr *ParseErr
+	if !errors.As(err, &perr) || perr.Line != 2 || perr.Field != "Mount_id" {
+		t.Errorf("ReadMountInfo(7): expected ParseErr at line 2, got %v\n", err)
+	} else {
+		fmt.Printf("ok bad mountinfo: %v\n", err)
+	}
+
+	_, err = r.ReadMountInfo(9)
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("ReadMountInfo(9): expected ErrProcessGone, got %v\n", err)
+	} else {
+		fmt.Printf("ok <9> gone: %v\n", err)
+	}
+
+	// still there, just no such file: not gone
+	_, err = r.ReadMountInfo(8)
+	if err == nil || errors.Is(err, ErrProcessGone) {
+		t.Errorf("ReadMountInfo(8): expected a plain error, got %v\n", err)
+	} else {
+		fmt.Printf("ok <8> missing: %v\n", err)
+	}
+}
@@ -0,0 +1,323 @@
+package procreader
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+/*
+ * /proc/net only shows the network namespace of the reader, while
+ * /proc/<pid>/net shows that of <pid>. All of the readers here take a pid so
+ * they can be pointed at (for example) a process inside a container. Internally
+ * pid 0 means /proc/net.
+ */
+
+type NetDev_t struct {
+	// fields from a line of /proc/<pid>/net/dev
+
+	Iface         string // interface name
+	Rx_bytes      uint64 // bytes received
+	Rx_packets    uint64 // packets received
+	Rx_errs       uint64 // receive errors
+	Rx_drop       uint64 // received packets dropped
+	Rx_fifo       uint64 // receive FIFO buffer errors
+	Rx_frame      uint64 // receive packet framing errors
+	Rx_compressed uint64 // compressed packets received
+	Rx_multicast  uint64 // multicast frames received
+	Tx_bytes      uint64 // bytes transmitted
+	Tx_packets    uint64 // packets transmitted
+	Tx_errs       uint64 // transmit errors
+	Tx_drop       uint64 // transmitted packets dropped
+	Tx_fifo       uint64 // transmit FIFO buffer errors
+	Tx_colls      uint64 // collisions detected
+	Tx_carrier    uint64 // carrier losses
+	Tx_compressed uint64 // compressed packets transmitted
+}
+
+// NetCounters holds the contents of /proc/<pid>/net/{snmp,netstat} indexed by
+// section and then counter, eg. ["Tcp"]["CurrEstab"] or ["TcpExt"]["ListenDrops"].
+type NetCounters map[string]map[string]int64
+
+type Route_t struct {
+	// fields from a line of /proc/<pid>/net/route
+
+	Iface       string // interface the route uses
+	Destination net.IP // destination network
+	Gateway     net.IP // gateway (0.0.0.0 for directly connected)
+	Flags       uint64 // RTF_* flags (RTF_UP 0x1, RTF_GATEWAY 0x2, RTF_HOST 0x4, ...)
+	RefCnt      uint64 // number of references to the route
+	Use         uint64 // count of lookups for the route
+	Metric      uint64 // distance to the target
+	Mask        net.IP // destination netmask
+	MTU         uint64 // MTU for TCP over this route
+	Window      uint64 // TCP window size over this route
+	IRTT        uint64 // initial round trip time
+}
+
+// readNetLines is readLines for /proc/<pid>/net/<filename>, or
+// /proc/net/<filename> when pid is 0.
+func readNetLines(cfg *procConfig, pid uint64, filename string) ([]string, error) {
+	if pid == 0 {
+		return readSystemLines(cfg, "net/"+filename)
+	}
+	return readLines(cfg, pid, "net/"+filename)
+}
+
+// parseHexIP decodes an address from /proc/net files, which are made up of
+// 32-bit words in host byte order. Errors are for the caller to make a
+// parseError() of.
+func parseHexIP(s string) (net.IP, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil, fmt.Errorf("bad address '%s'", s)
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+
+	return ip, nil
+}
+
+// names of the counters of NetDev_t, in the order of /proc/net/dev
+var netDevFields = [...]string{
+	"Rx_bytes", "Rx_packets", "Rx_errs", "Rx_drop", "Rx_fifo", "Rx_frame",
+	"Rx_compressed", "Rx_multicast", "Tx_bytes", "Tx_packets", "Tx_errs",
+	"Tx_drop", "Tx_fifo", "Tx_colls", "Tx_carrier", "Tx_compressed",
+}
+
+func readNetDev(cfg *procConfig, pid uint64) ([]NetDev_t, error) {
+	var devs []NetDev_t
+
+	lines, err := readNetLines(cfg, pid, "dev")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	// first two lines are headers
+	for i := 2; i < len(lines); i++ {
+		var dev NetDev_t
+		var values [16]uint64
+
+		// older kernels have no space between the ':' and the first value
+		parts := strings.SplitN(lines[i], ":", 2)
+		if len(parts) != 2 {
+			return nil, parseError("net/dev", i+1, "", fmt.Errorf("unexpected format: '%s'", lines[i]))
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) != len(values) {
+			return nil, parseError("net/dev", i+1, "",
+				fmt.Errorf("expected %d fields, got %d: '%s'", len(values), len(fields), lines[i]))
+		}
+		for f := range fields {
+			values[f], err = strconv.ParseUint(fields[f], 10, 64)
+			if err != nil {
+				return nil, parseError("net/dev", i+1, netDevFields[f], err)
+			}
+		}
+
+		dev.Iface = strings.TrimSpace(parts[0])
+		dev.Rx_bytes = values[0]
+		dev.Rx_packets = values[1]
+		dev.Rx_errs = values[2]
+		dev.Rx_drop = values[3]
+		dev.Rx_fifo = values[4]
+		dev.Rx_frame = values[5]
+		dev.Rx_compressed = values[6]
+		dev.Rx_multicast = values[7]
+		dev.Tx_bytes = values[8]
+		dev.Tx_packets = values[9]
+		dev.Tx_errs = values[10]
+		dev.Tx_drop = values[11]
+		dev.Tx_fifo = values[12]
+		dev.Tx_colls = values[13]
+		dev.Tx_carrier = values[14]
+		dev.Tx_compressed = values[15]
+
+		devs = append(devs, dev)
+	}
+
+	return devs, nil
+}
+
+// readNetCounters parses the format shared by snmp and netstat: pairs of lines
+// with the same '<Section>:' prefix, the first with names, the second values.
+func readNetCounters(cfg *procConfig, pid uint64, filename string) (NetCounters, error) {
+	var counters = make(NetCounters)
+
+	lines, err := readNetLines(cfg, pid, filename)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for i := 0; i+1 < len(lines); i += 2 {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+
+		if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+			return nil, parseError("net/"+filename, i+2, "",
+				fmt.Errorf("mismatched lines: '%s' / '%s'", lines[i], lines[i+1]))
+		}
+
+		section := strings.TrimSuffix(names[0], ":")
+		if counters[section] == nil {
+			counters[section] = make(map[string]int64)
+		}
+		for j := 1; j < len(names); j++ {
+			// some (eg. Tcp MaxConn) can be -1
+			val, err := strconv.ParseInt(values[j], 10, 64)
+			if err != nil {
+				return nil, parseError("net/"+filename, i+2, section+"."+names[j], err)
+			}
+			counters[section][names[j]] = val
+		}
+	}
+
+	return counters, nil
+}
+
+// the numeric columns of /proc/net/route readNetRoute() parses, for errors
+var routeFields = [...]string{"Flags", "RefCnt", "Use", "Metric", "MTU", "Window", "IRTT"}
+
+func readNetRoute(cfg *procConfig, pid uint64) ([]Route_t, error) {
+	var routes []Route_t
+
+	lines, err := readNetLines(cfg, pid, "route")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	// first line is the header
+	for i := 1; i < len(lines); i++ {
+		var route Route_t
+		var values [7]uint64
+
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fields := strings.Fields(lines[i])
+		if len(fields) != 11 {
+			return nil, parseError("net/route", i+1, "",
+				fmt.Errorf("expected 11 fields, got %d: '%s'", len(fields), lines[i]))
+		}
+
+		route.Iface = fields[0]
+		route.Destination, err = parseHexIP(fields[1])
+		if err != nil {
+			return nil, parseError("net/route", i+1, "Destination", err)
+		}
+		route.Gateway, err = parseHexIP(fields[2])
+		if err != nil {
+			return nil, parseError("net/route", i+1, "Gateway", err)
+		}
+		route.Mask, err = parseHexIP(fields[7])
+		if err != nil {
+			return nil, parseError("net/route", i+1, "Mask", err)
+		}
+
+		for v, f := range []int{3, 4, 5, 6, 8, 9, 10} {
+			base := 10
+			if f == 3 {
+				// flags are hex
+				base = 16
+			}
+			values[v], err = strconv.ParseUint(fields[f], base, 64)
+			if err != nil {
+				return nil, parseError("net/route", i+1, routeFields[v], err)
+			}
+		}
+		route.Flags = values[0]
+		route.RefCnt = values[1]
+		route.Use = values[2]
+		route.Metric = values[3]
+		route.MTU = values[4]
+		route.Window = values[5]
+		route.IRTT = values[6]
+
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// This function reads /proc/<pid>/net/dev and returns the interface counters in
+// the network namespace of the specified process.
+func ReadNetDev(pid uint64) ([]NetDev_t, error) {
+	return defaultReader.ReadNetDev(pid)
+}
+
+// ReadNetDev is ReadNetDev() for the proc filesystem in r.
+func (r *Reader) ReadNetDev(pid uint64) ([]NetDev_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	devs, err := readNetDev(&cfg, pid)
+	return devs, pidError(&cfg, pid, err)
+}
+
+// This function reads /proc/<pid>/net/{tcp,tcp6,udp,udp6,raw,raw6,unix} and
+// returns all sockets in the network namespace of the specified process. Pids
+// is not set on the results.
+func ReadNetSockets(pid uint64) ([]Socket_t, error) {
+	return defaultReader.ReadNetSockets(pid)
+}
+
+// ReadNetSockets is ReadNetSockets() for the proc filesystem in r.
+func (r *Reader) ReadNetSockets(pid uint64) ([]Socket_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	socks, err := readSockets(&cfg, pid)
+	return socks, pidError(&cfg, pid, err)
+}
+
+// This function reads /proc/<pid>/net/snmp (IP, ICMP, TCP and UDP counters) for
+// the network namespace of the specified process.
+func ReadNetSnmp(pid uint64) (NetCounters, error) {
+	return defaultReader.ReadNetSnmp(pid)
+}
+
+// ReadNetSnmp is ReadNetSnmp() for the proc filesystem in r.
+func (r *Reader) ReadNetSnmp(pid uint64) (NetCounters, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	counters, err := readNetCounters(&cfg, pid, "snmp")
+	return counters, pidError(&cfg, pid, err)
+}
+
+// This function reads /proc/<pid>/net/netstat (TcpExt, IpExt, ... counters) for
+// the network namespace of the specified process.
+func ReadNetNetstat(pid uint64) (NetCounters, error) {
+	return defaultReader.ReadNetNetstat(pid)
+}
+
+// ReadNetNetstat is ReadNetNetstat() for the proc filesystem in r.
+func (r *Reader) ReadNetNetstat(pid uint64) (NetCounters, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	counters, err := readNetCounters(&cfg, pid, "netstat")
+	return counters, pidError(&cfg, pid, err)
+}
+
+// This function reads /proc/<pid>/net/route and returns the IPv4 routing table
+// of the network namespace of the specified process.
+func ReadNetRoute(pid uint64) ([]Route_t, error) {
+	return defaultReader.ReadNetRoute(pid)
+}
+
+// ReadNetRoute is ReadNetRoute() for the proc filesystem in r.
+func (r *Reader) ReadNetRoute(pid uint64) ([]Route_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	routes, err := readNetRoute(&cfg, pid)
+	return routes, pidError(&cfg, pid, err)
+}
@@ -0,0 +1,78 @@
+package procreader
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestReadNetNamespace(t *testing.T) {
+	var cfg procConfig
+
+	// a container's network namespace, only readable through /proc/<pid>/net
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo:    1234      12    0    0    0     0          0         0     1234      12    0    0    0     0       0          0\n" +
+			"  eth0:98765432   65432    1    2    0     0          0        10 12345678   54321    0    3    0     0       0          0\n",
+		"net/snmp": "Ip: Forwarding DefaultTTL InReceives\nIp: 1 64 65432\n" +
+			"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens CurrEstab\nTcp: 1 200 120000 -1 17 3\n",
+		"net/netstat": "TcpExt: SyncookiesSent ListenOverflows ListenDrops\nTcpExt: 0 5 7\n",
+		"net/route": "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			"eth0\t00000000\t010011AC\t0003\t0\t0\t0\t00000000\t0\t0\t0\n" +
+			"eth0\t000011AC\t00000000\t0001\t0\t0\t0\t0000FFFF\t0\t0\t0\n",
+		"net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 41000 1 0000000000000000 100 0 0 10 0\n",
+	}
+
+	devs, err := readNetDev(&cfg, 4242)
+	if err != nil {
+		t.Fatalf("readNetDev: %s\n", err.Error())
+	}
+	expected := NetDev_t{Iface: "eth0", Rx_bytes: 98765432, Rx_packets: 65432, Rx_errs: 1, Rx_drop: 2,
+		Rx_multicast: 10, Tx_bytes: 12345678, Tx_packets: 54321, Tx_drop: 3}
+	if len(devs) != 2 || devs[0].Iface != "lo" || !reflect.DeepEqual(devs[1], expected) {
+		t.Errorf("readNetDev: actual != expected: %#v\n", devs)
+	} else {
+		fmt.Printf("ok net/dev matches\n")
+	}
+
+	snmp, err := readNetCounters(&cfg, 4242, "snmp")
+	if err != nil {
+		t.Errorf("readNetCounters(snmp): %s\n", err.Error())
+	} else if snmp["Tcp"]["CurrEstab"] != 3 || snmp["Tcp"]["MaxConn"] != -1 || snmp["Ip"]["InReceives"] != 65432 {
+		t.Errorf("readNetCounters(snmp): actual != expected: %#v\n", snmp)
+	} else {
+		fmt.Printf("ok net/snmp matches\n")
+	}
+
+	netstat, err := readNetCounters(&cfg, 4242, "netstat")
+	if err != nil {
+		t.Errorf("readNetCounters(netstat): %s\n", err.Error())
+	} else if netstat["TcpExt"]["ListenDrops"] != 7 {
+		t.Errorf("readNetCounters(netstat): actual != expected: %#v\n", netstat)
+	} else {
+		fmt.Printf("ok net/netstat matches\n")
+	}
+
+	routes, err := readNetRoute(&cfg, 4242)
+	if err != nil {
+		t.Errorf("readNetRoute: %s\n", err.Error())
+	} else if len(routes) != 2 || routes[0].Gateway.String() != "172.17.0.1" || routes[0].Flags != 0x3 ||
+		routes[1].Destination.String() != "172.17.0.0" || routes[1].Mask.String() != "255.255.0.0" {
+		t.Errorf("readNetRoute: actual != expected: %#v\n", routes)
+	} else {
+		fmt.Printf("ok net/route matches\n")
+	}
+
+	// the per-process tables, not /proc/net, are used
+	socks, err := readSockets(&cfg, 4242)
+	if err != nil {
+		t.Errorf("readSockets: %s\n", err.Error())
+	} else if len(socks) != 1 || socks[0].Inode != 41000 {
+		t.Errorf("readSockets: actual != expected: %#v\n", socks)
+	} else {
+		fmt.Printf("ok net/tcp matches\n")
+	}
+}
@@ -0,0 +1,619 @@
+package procreader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Hand written parsers for the files read for every process, which avoid the
+ * reflection and copying of the generic code since they're read so often.
+ */
+
+// names of the fields of Stat_t, in the order of /proc/<pid>/stat
+var statFields = [...]string{
+	"Pid", "Tcomm", "State", "Ppid", "Pgrp", "Sid", "Tty_nr", "Tty_pgrp",
+	"Flags", "Min_flt", "Cmin_flt", "Maj_flt", "Cmaj_flt", "Utime", "Stime",
+	"Cutime", "Cstime", "Priority", "Nice", "Num_threads", "it_real_value",
+	"Start_time", "Vsize", "Rss", "Rsslim", "Start_code", "End_code",
+	"Start_stack", "Esp", "Eip", "Pending", "Blocked", "Sigign", "Sigcatch",
+	"Wchan", "placeholder1", "placeholder2", "Exit_signal", "Task_cpu",
+	"Rt_priority", "Policy", "Blkio_ticks", "Gtime", "Cgtime", "Start_data",
+	"End_data", "Start_brk", "Arg_start", "Arg_end", "Env_start", "Env_end",
+	"Exit_code",
+}
+
+// the index of Start_time in statFields
+const statStartTime = 21
+
+// names of the fields of Statm_t, in the order of /proc/<pid>/statm
+var statmFields = [...]string{
+	"Size", "Resident", "Shared", "Trs", "Lrs", "Drs", "Dt",
+}
+
+// readBuffer reads <pid>/<filename> into cfg.buf, which is reused so the
+// result is only valid until the next call. Like readLines() it uses (and
+// fills in) cfg.contents.
+func readBuffer(cfg *procConfig, pid uint64, filename string) ([]byte, error) {
+	if contents, ok := cfg.contents[filename]; ok {
+		cfg.buf = append(cfg.buf[:0], contents...)
+		return cfg.buf, nil
+	}
+
+	file, err := cfg.fsys.Open(strconv.FormatUint(pid, 10) + "/" + filename)
+	if err != nil {
+		return nil, withContext(err, pid, filename)
+	}
+	defer file.Close()
+
+	// the size of proc files is unknown (stat(2) says 0), so read until EOF
+	buf := cfg.buf[:0]
+	if cap(buf) == 0 {
+		buf = make([]byte, 0, 512)
+	}
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := file.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cfg.buf = buf
+			return nil, withContext(err, pid, filename)
+		}
+	}
+	cfg.buf = buf
+
+	// for generating test cases, having the input is required
+	if cfg.contents != nil {
+		cfg.contents[filename] = string(buf)
+	}
+
+	return buf, nil
+}
+
+// readString is readBuffer() returning a string, which (once cfg.buf is big
+// enough) is the only allocation.
+func readString(cfg *procConfig, pid uint64, filename string) (string, error) {
+	if contents, ok := cfg.contents[filename]; ok {
+		return contents, nil
+	}
+
+	data, err := readBuffer(cfg, pid, filename)
+	if err != nil {
+		return "", err
+	}
+	if cfg.contents != nil {
+		return cfg.contents[filename], nil
+	}
+
+	return string(data), nil
+}
+
+// splitNull appends the NUL terminated strings in contents to strs and returns
+// it. The strings share contents' memory. Anything after the last NUL (eg. a
+// process overwrote its arguments) is ignored.
+func splitNull(strs []string, contents string) []string {
+	for {
+		i := strings.IndexByte(contents, 0)
+		if i < 0 {
+			return strs
+		}
+		strs = append(strs, contents[:i])
+		contents = contents[i+1:]
+	}
+}
+
+// singleLine returns the line in data without its newline, or an error if
+// there isn't exactly one line.
+func singleLine(file string, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, parseError(file, 0, "", fmt.Errorf("expected 1 line, got 0"))
+	}
+	line := bytes.TrimSuffix(data, []byte{'\n'})
+	if n := bytes.Count(line, []byte{'\n'}); n > 0 {
+		return nil, parseError(file, 0, "", fmt.Errorf("expected 1 line, got %d", n+1))
+	}
+	return line, nil
+}
+
+// fieldScanner returns the fields of a line separated by single spaces, like
+// strings.Split(line, " ") but without allocating.
+type fieldScanner struct {
+	line []byte
+	done bool
+}
+
+func (s *fieldScanner) next() ([]byte, bool) {
+	if s.done {
+		return nil, false
+	}
+	i := bytes.IndexByte(s.line, ' ')
+	if i < 0 {
+		s.done = true
+		return s.line, true
+	}
+	field := s.line[:i]
+	s.line = s.line[i+1:]
+	return field, true
+}
+
+// parseUint is strconv.ParseUint(string(b), 10, bits) without the copy.
+func parseUint(b []byte, bits int) (uint64, error) {
+	var n uint64
+
+	max := uint64(1)<<uint(bits) - 1
+	if bits == 64 {
+		max = 1<<64 - 1
+	}
+	if len(b) == 0 {
+		return 0, &strconv.NumError{Func: "ParseUint", Num: string(b), Err: strconv.ErrSyntax}
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, &strconv.NumError{Func: "ParseUint", Num: string(b), Err: strconv.ErrSyntax}
+		}
+		d := uint64(c - '0')
+		if n > (max-d)/10 {
+			return max, &strconv.NumError{Func: "ParseUint", Num: string(b), Err: strconv.ErrRange}
+		}
+		n = n*10 + d
+	}
+
+	return n, nil
+}
+
+// parseInt is strconv.ParseInt(string(b), 10, bits) without the copy.
+func parseInt(b []byte, bits int) (int64, error) {
+	var neg bool
+
+	digits := b
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		digits = b[1:]
+	}
+
+	u, err := parseUint(digits, 64)
+	if err != nil && err.(*strconv.NumError).Err != strconv.ErrRange {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: string(b), Err: err.(*strconv.NumError).Err}
+	}
+
+	// too big for a uint64 is out of range too
+	limit := uint64(1) << uint(bits-1)
+	if !neg && u >= limit {
+		return int64(limit - 1), &strconv.NumError{Func: "ParseInt", Num: string(b), Err: strconv.ErrRange}
+	}
+	if neg && u > limit {
+		return -int64(limit-1) - 1, &strconv.NumError{Func: "ParseInt", Num: string(b), Err: strconv.ErrRange}
+	}
+	if neg {
+		return -int64(u), nil
+	}
+	return int64(u), nil
+}
+
+// internString returns common values (states and empty signal masks) without
+// allocating.
+func internString(b []byte) string {
+	if len(b) == 1 {
+		switch b[0] {
+		case '0':
+			return "0"
+		case 'R':
+			return "R"
+		case 'S':
+			return "S"
+		case 'D':
+			return "D"
+		case 'Z':
+			return "Z"
+		case 'T':
+			return "T"
+		case 't':
+			return "t"
+		case 'X':
+			return "X"
+		case 'I':
+			return "I"
+		}
+	}
+	return string(b)
+}
+
+// parseStat parses the line from /proc/<pid>/stat into stat. Fields missing
+// on older kernels are left zero, and any added since are ignored.
+func parseStat(line []byte, stat *Stat_t) error {
+	var err error
+
+	*stat = Stat_t{}
+
+	// The command is special in that it's '(<command>)' and we need to
+	// watch out for things like ')' in the <command>. We do what procps
+	// does and take everything between the first '(' and last ')'.
+	cmdStart := bytes.IndexByte(line, '(')
+	cmdEnd := bytes.LastIndexByte(line, ')')
+	if cmdStart < 1 || cmdEnd < cmdStart || cmdEnd+2 > len(line) {
+		return parseError("stat", 1, "Tcomm", fmt.Errorf("no '(<command>) ' in '%s'", line))
+	}
+
+	stat.Pid, err = parseUint(bytes.TrimSpace(line[:cmdStart]), 64)
+	if err != nil {
+		return parseError("stat", 1, "Pid", err)
+	}
+	stat.Tcomm = string(line[cmdStart+1 : cmdEnd])
+
+	s := fieldScanner{line: line[cmdEnd+2:]}
+	for i := 2; i < len(statFields); i++ {
+		var u uint64
+		var n int64
+
+		field, ok := s.next()
+		if !ok {
+			break
+		}
+
+		switch i {
+		case 2:
+			stat.State = internString(field)
+		case 3:
+			stat.Ppid, err = parseInt(field, 64)
+		case 4:
+			stat.Pgrp, err = parseInt(field, 64)
+		case 5:
+			stat.Sid, err = parseInt(field, 64)
+		case 6:
+			stat.Tty_nr, err = parseInt(field, 64)
+		case 7:
+			stat.Tty_pgrp, err = parseInt(field, 64)
+		case 17:
+			n, err = parseInt(field, 32)
+			stat.Priority = int32(n)
+		case 18:
+			n, err = parseInt(field, 32)
+			stat.Nice = int32(n)
+		case 19:
+			u, err = parseUint(field, 32)
+			stat.Num_threads = uint32(u)
+		case 20, 35, 36:
+			// it_real_value and the placeholders aren't kept
+		case 30:
+			stat.Pending = internString(field)
+		case 31:
+			stat.Blocked = internString(field)
+		case 32:
+			stat.Sigign = internString(field)
+		case 33:
+			stat.Sigcatch = internString(field)
+		default:
+			p := statUint64(stat, i)
+			if p == nil {
+				return newError("parseStat(): unhandled field '%s'", statFields[i])
+			}
+			*p, err = parseUint(field, 64)
+		}
+		if err != nil {
+			return parseError("stat", 1, statFields[i], err)
+		}
+	}
+
+	return nil
+}
+
+// parseStartTime returns just Start_time from the line from /proc/<pid>/stat.
+func parseStartTime(line []byte) (uint64, error) {
+	cmdEnd := bytes.LastIndexByte(line, ')')
+	if cmdEnd < 0 || cmdEnd+2 > len(line) {
+		return 0, parseError("stat", 1, "Tcomm", fmt.Errorf("no '(<command>) ' in '%s'", line))
+	}
+
+	s := fieldScanner{line: line[cmdEnd+2:]}
+	for i := 2; ; i++ {
+		field, ok := s.next()
+		if !ok {
+			return 0, parseError("stat", 1, "Start_time", fmt.Errorf("expected %d fields, got %d", statStartTime+1, i))
+		}
+		if i == statStartTime {
+			start, err := parseUint(field, 64)
+			if err != nil {
+				return 0, parseError("stat", 1, "Start_time", err)
+			}
+			return start, nil
+		}
+	}
+}
+
+// statUint64 returns the uint64 field of stat at index i of statFields, or nil
+// if it isn't one.
+func statUint64(stat *Stat_t, i int) *uint64 {
+	switch i {
+	case 8:
+		return &stat.Flags
+	case 9:
+		return &stat.Min_flt
+	case 10:
+		return &stat.Cmin_flt
+	case 11:
+		return &stat.Maj_flt
+	case 12:
+		return &stat.Cmaj_flt
+	case 13:
+		return &stat.Utime
+	case 14:
+		return &stat.Stime
+	case 15:
+		return &stat.Cutime
+	case 16:
+		return &stat.Cstime
+	case 21:
+		return &stat.Start_time
+	case 22:
+		return &stat.Vsize
+	case 23:
+		return &stat.Rss
+	case 24:
+		return &stat.Rsslim
+	case 25:
+		return &stat.Start_code
+	case 26:
+		return &stat.End_code
+	case 27:
+		return &stat.Start_stack
+	case 28:
+		return &stat.Esp
+	case 29:
+		return &stat.Eip
+	case 34:
+		return &stat.Wchan
+	case 37:
+		return &stat.Exit_signal
+	case 38:
+		return &stat.Task_cpu
+	case 39:
+		return &stat.Rt_priority
+	case 40:
+		return &stat.Policy
+	case 41:
+		return &stat.Blkio_ticks
+	case 42:
+		return &stat.Gtime
+	case 43:
+		return &stat.Cgtime
+	case 44:
+		return &stat.Start_data
+	case 45:
+		return &stat.End_data
+	case 46:
+		return &stat.Start_brk
+	case 47:
+		return &stat.Arg_start
+	case 48:
+		return &stat.Arg_end
+	case 49:
+		return &stat.Env_start
+	case 50:
+		return &stat.Env_end
+	case 51:
+		return &stat.Exit_code
+	}
+	return nil
+}
+
+// parseStatm parses the line from /proc/<pid>/statm into statm.
+func parseStatm(line []byte, statm *Statm_t) error {
+	var values [len(statmFields)]uint64
+	var err error
+
+	s := fieldScanner{line: line}
+	for i := range values {
+		field, ok := s.next()
+		if !ok {
+			return parseError("statm", 1, "", fmt.Errorf("expected %d fields, got %d", len(values), i))
+		}
+		values[i], err = parseUint(field, 64)
+		if err != nil {
+			return parseError("statm", 1, statmFields[i], err)
+		}
+	}
+
+	*statm = Statm_t{
+		Size:     values[0],
+		Resident: values[1],
+		Shared:   values[2],
+		Trs:      values[3],
+		Lrs:      values[4],
+		Drs:      values[5],
+		Dt:       values[6],
+	}
+
+	return nil
+}
+
+// statusUint64 returns the uint64 field of status for key in
+// /proc/<pid>/status, or nil if it isn't one.
+func statusUint64(status *Status_t, key string) *uint64 {
+	switch key {
+	case "Tgid":
+		return &status.Tgid
+	case "Ngid":
+		return &status.Ngid
+	case "Pid":
+		return &status.Pid
+	case "PPid":
+		return &status.PPid
+	case "TracerPid":
+		return &status.TracerPid
+	case "FDSize":
+		return &status.FDSize
+	case "VmPeak":
+		return &status.VmPeak
+	case "VmSize":
+		return &status.VmSize
+	case "VmLck":
+		return &status.VmLck
+	case "VmPin":
+		return &status.VmPin
+	case "VmHWM":
+		return &status.VmHWM
+	case "VmRSS":
+		return &status.VmRSS
+	case "VmData":
+		return &status.VmData
+	case "VmStk":
+		return &status.VmStk
+	case "VmExe":
+		return &status.VmExe
+	case "VmLib":
+		return &status.VmLib
+	case "VmPTE":
+		return &status.VmPTE
+	case "VmSwap":
+		return &status.VmSwap
+	case "Threads":
+		return &status.Threads
+	case "Seccomp":
+		return &status.Seccomp
+	case "voluntary_ctxt_switches":
+		return &status.Voluntary_ctxt_switches
+	case "nonvoluntary_ctxt_switches":
+		return &status.Nonvoluntary_ctxt_switches
+	}
+	return nil
+}
+
+// statusString returns the string field of status for key in
+// /proc/<pid>/status, or nil if it isn't one.
+func statusString(status *Status_t, key string) *string {
+	switch key {
+	case "Name":
+		return &status.Name
+	case "State":
+		return &status.State
+	case "SigPnd":
+		return &status.SigPnd
+	case "ShdPnd":
+		return &status.ShdPnd
+	case "SigBlk":
+		return &status.SigBlk
+	case "SigIgn":
+		return &status.SigIgn
+	case "SigCgt":
+		return &status.SigCgt
+	case "CapInh":
+		return &status.CapInh
+	case "CapPrm":
+		return &status.CapPrm
+	case "CapEff":
+		return &status.CapEff
+	case "CapBnd":
+		return &status.CapBnd
+	case "Cpus_allowed":
+		return &status.Cpus_allowed
+	case "Cpus_allowed_list":
+		return &status.Cpus_allowed_list
+	case "Mems_allowed":
+		return &status.Mems_allowed
+	case "Mems_allowed_list":
+		return &status.Mems_allowed_list
+	}
+	return nil
+}
+
+// parseStatusIds parses the tab separated real, effective, saved set and
+// filesystem IDs of the Uid and Gid lines.
+func parseStatusIds(value string, ids *Ids) error {
+	var values [4]uint64
+	var err error
+
+	for i := range values {
+		var field string
+
+		field, value, _ = strings.Cut(value, "\t")
+		if field == "" {
+			return fmt.Errorf("expected %d fields, got %d", len(values), i)
+		}
+		values[i], err = strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	if value != "" {
+		return fmt.Errorf("expected %d fields, got more: '%s'", len(values), value)
+	}
+
+	*ids = Ids{Real: values[0], Effective: values[1], Saved: values[2], FS: values[3]}
+	return nil
+}
+
+// parseStatus parses the contents of /proc/<pid>/status into status, appending
+// to its Groups. Its strings share contents' memory. Keys Status_t doesn't
+// have are skipped: either gone since older kernels (eg. SleepAVG) or added
+// since (eg. Umask, NSpid, CapAmb).
+func parseStatus(contents string, status *Status_t) error {
+	var err error
+
+	for line := 1; contents != ""; line++ {
+		var text string
+
+		text, contents, _ = strings.Cut(contents, "\n")
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || key == "" {
+			return parseError("status", line, "", fmt.Errorf("expected '<key>: <value>', got '%s'", text))
+		}
+		value = strings.TrimSpace(value)
+
+		if s := statusString(status, key); s != nil {
+			*s = value
+			continue
+		}
+		if u := statusUint64(status, key); u != nil {
+			*u, err = strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+			if err != nil {
+				return parseError("status", line, key, err)
+			}
+			continue
+		}
+
+		switch key {
+		case "Uid":
+			err = parseStatusIds(value, &status.Uid)
+		case "Gid":
+			err = parseStatusIds(value, &status.Gid)
+		case "SigQ":
+			num, max, ok := strings.Cut(value, "/")
+			if !ok {
+				err = fmt.Errorf("expected '<num>/<max>', got '%s'", value)
+				break
+			}
+			status.SigQ.Num, err = strconv.ParseUint(num, 10, 64)
+			if err == nil {
+				status.SigQ.Max, err = strconv.ParseUint(max, 10, 64)
+			}
+		case "Groups":
+			for value != "" {
+				var group string
+				var gid uint64
+
+				group, value, _ = strings.Cut(value, " ")
+				if group == "" {
+					continue
+				}
+				gid, err = strconv.ParseUint(group, 10, 64)
+				if err != nil {
+					break
+				}
+				status.Groups = append(status.Groups, gid)
+			}
+		}
+		if err != nil {
+			return parseError("status", line, key, err)
+		}
+	}
+
+	return nil
+}
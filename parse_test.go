@@ -0,0 +1,459 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// reflectReadStat is how readStat() used to parse stat, kept to check the
+// hand written parser against and to benchmark it with.
+func reflectReadStat(cfg *procConfig, pid uint64, proc *Proc) error {
+	var stat Stat_t
+
+	lines, err := readLines(cfg, pid, "stat")
+	if err != nil {
+		return wrapError(err)
+	}
+	if len(lines) != 1 {
+		return newError("expected 1 line, got %d", len(lines))
+	}
+
+	s := reflect.ValueOf(&stat).Elem()
+
+	cmd_end := strings.LastIndex(lines[0], ")")
+	cmd_start := strings.Index(lines[0], "(") + 1
+	fields := strings.Split(lines[0][cmd_end+2:], " ")
+	fields = append([]string{lines[0][0 : cmd_start-1],
+		lines[0][cmd_start:cmd_end]}, fields...)
+
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+
+		if !f.CanSet() || i >= len(fields) {
+			continue
+		}
+
+		switch f.Type().String() {
+		case "int32":
+			u, err := strconv.ParseInt(strings.TrimSpace(fields[i]), 10, 32)
+			if err != nil {
+				return wrapError(err)
+			}
+			s.Field(i).SetInt(u)
+		case "int64":
+			u, err := strconv.ParseInt(strings.TrimSpace(fields[i]), 10, 64)
+			if err != nil {
+				return wrapError(err)
+			}
+			s.Field(i).SetInt(u)
+		case "uint32":
+			u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 32)
+			if err != nil {
+				return wrapError(err)
+			}
+			s.Field(i).SetUint(u)
+		case "uint64":
+			u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 64)
+			if err != nil {
+				return wrapError(err)
+			}
+			s.Field(i).SetUint(u)
+		case "string":
+			s.Field(i).SetString(fields[i])
+		}
+	}
+
+	proc.Stat = stat
+	return nil
+}
+
+// reflectReadStatm is how readStatm() used to parse statm.
+func reflectReadStatm(cfg *procConfig, pid uint64, proc *Proc) error {
+	var statm Statm_t
+
+	lines, err := readLines(cfg, pid, "statm")
+	if err != nil {
+		return wrapError(err)
+	}
+
+	s := reflect.ValueOf(&statm).Elem()
+	fields := strings.Split(lines[0], " ")
+	for i := 0; i < s.NumField(); i++ {
+		u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 64)
+		if err != nil {
+			return wrapError(err)
+		}
+		s.Field(i).SetUint(u)
+	}
+
+	proc.Statm = statm
+	return nil
+}
+
+// reflectReadStatus is how readStatus() used to parse status.
+func reflectReadStatus(cfg *procConfig, pid uint64, proc *Proc) error {
+	var err error
+	var statusMap = make(map[string]reflect.Value)
+	var status Status_t
+
+	contents, err := readString(cfg, pid, "status")
+	if err != nil {
+		return wrapError(err)
+	}
+	lines, err := splitLines(contents)
+	if err != nil {
+		return wrapError(err)
+	}
+	// reuse the caller's slice, see ReadProcInto()
+	status.Groups = proc.Status.Groups[:0]
+
+	s := reflect.ValueOf(&status).Elem()
+	typeOfS := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		statusMap[typeOfS.Field(i).Name] = s.Field(i)
+	}
+
+	for line := range lines {
+		key, value, ok := strings.Cut(lines[line], ":")
+		if !ok || key == "" {
+			return parseError("status", line+1, "", fmt.Errorf("expected '<key>: <value>', got '%s'", lines[line]))
+		}
+		name := key
+		value = strings.TrimSpace(value)
+
+		f := statusMap[name]
+		if !f.IsValid() {
+			// not valid, see if capitalizing first character fixes
+			a := []rune(name)
+			a[0] = unicode.ToUpper(a[0])
+			name = string(a)
+
+			f = statusMap[name]
+			if !f.IsValid() {
+				// Not one we keep: either gone since older kernels (eg.
+				// SleepAVG) or added since (eg. Umask, NSpid, CapAmb).
+				continue
+			}
+		}
+
+		switch f.Type().String() {
+		case "procreader.Ids":
+			if name == "Uid" {
+				cnt, err := fmt.Sscanf(value, "%d\t%d\t%d\t%d",
+					&status.Uid.Real, &status.Uid.Effective,
+					&status.Uid.Saved, &status.Uid.FS,
+				)
+				if err != nil {
+					return parseError("status", line+1, name, err)
+				}
+				if cnt != 4 {
+					return parseError("status", line+1, name, fmt.Errorf("expected 4 fields, got %d: '%s'", cnt, value))
+				}
+			} else if name == "Gid" {
+				cnt, err := fmt.Sscanf(value, "%d\t%d\t%d\t%d",
+					&status.Gid.Real, &status.Gid.Effective,
+					&status.Gid.Saved, &status.Gid.FS,
+				)
+				if err != nil {
+					return parseError("status", line+1, name, err)
+				}
+				if cnt != 4 {
+					return parseError("status", line+1, name, fmt.Errorf("expected 4 fields, got %d: '%s'", cnt, value))
+				}
+			} else {
+				return newError("readStatus: Internal Error: %s not supported for type Ids", name)
+			}
+		case "procreader.SigQVal":
+			cnt, err := fmt.Sscanf(value, "%d/%d", &status.SigQ.Num, &status.SigQ.Max)
+			if err != nil {
+				return parseError("status", line+1, name, err)
+			}
+			if cnt != 2 {
+				return parseError("status", line+1, name, fmt.Errorf("expected 2 fields, got %d: '%s'", cnt, value))
+			}
+		case "[]uint64":
+			if name != "Groups" {
+				return newError("readStatus: Internal Error: %s not supported for type []uint64", name)
+			}
+			groups := strings.Split(value, " ")
+			for g := range groups {
+				if len(groups[g]) == 0 {
+					continue
+				}
+				val, err := strconv.ParseUint(groups[g], 10, 64)
+				if err != nil {
+					return parseError("status", line+1, name, err)
+				}
+				status.Groups = append(status.Groups, val)
+			}
+		case "string":
+			f.SetString(value)
+		case "uint64":
+			if strings.HasSuffix(value, " kB") {
+				value = value[:len(value)-3]
+			}
+			u, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return parseError("status", line+1, name, err)
+			}
+			f.SetUint(u)
+		default:
+			return newError("readStatus(): unhandled type '%s' for '%s'", f.Type().String(), name)
+		}
+	}
+
+	proc.Status = status
+
+	return nil
+}
+
+func TestStatFields(t *testing.T) {
+	for _, test := range []struct {
+		value  interface{}
+		fields []string
+	}{
+		{Stat_t{}, statFields[:]},
+		{Statm_t{}, statmFields[:]},
+	} {
+		typ := reflect.TypeOf(test.value)
+		if typ.NumField() != len(test.fields) {
+			t.Errorf("%s: %d fields, but %d names\n", typ.Name(), typ.NumField(), len(test.fields))
+			continue
+		}
+		for i := range test.fields {
+			if typ.Field(i).Name != test.fields[i] {
+				t.Errorf("%s: field %d is %s, not %s\n", typ.Name(), i, typ.Field(i).Name, test.fields[i])
+			}
+		}
+		fmt.Printf("ok %s field names\n", typ.Name())
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	inputs := []string{
+		"0", "1", "42", "-1", "+7", "-", "", " 1", "1x", "0x10",
+		"4294967295", "4294967296", "2147483647", "2147483648", "-2147483648", "-2147483649",
+		"18446744073709551615", "18446744073709551616",
+		"9223372036854775807", "9223372036854775808", "-9223372036854775808", "-9223372036854775809",
+	}
+
+	for _, input := range inputs {
+		for _, bits := range []int{32, 64} {
+			u, err := parseUint([]byte(input), bits)
+			expectU, expectErr := strconv.ParseUint(input, 10, bits)
+			if u != expectU || fmt.Sprint(err) != fmt.Sprint(expectErr) {
+				t.Errorf("parseUint(%q, %d): got %d (%v), expected %d (%v)\n",
+					input, bits, u, err, expectU, expectErr)
+			}
+			n, err := parseInt([]byte(input), bits)
+			expectN, expectErr := strconv.ParseInt(input, 10, bits)
+			if n != expectN || fmt.Sprint(err) != fmt.Sprint(expectErr) {
+				t.Errorf("parseInt(%q, %d): got %d (%v), expected %d (%v)\n",
+					input, bits, n, err, expectN, expectErr)
+			}
+		}
+	}
+	fmt.Printf("ok parseUint() and parseInt() match strconv\n")
+}
+
+func TestParseStat(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+
+	for pid, tc := range testCases {
+		var proc, expected Proc
+
+		cfg.contents = map[string]string{
+			"stat":  tc.statContent,
+			"statm": tc.statmContent,
+		}
+		err := readStat(&cfg, pid, &proc)
+		if err == nil {
+			err = readStatm(&cfg, pid, &proc)
+		}
+		if err != nil {
+			t.Errorf("<%d> %v\n", pid, err)
+			continue
+		}
+		err = reflectReadStat(&cfg, pid, &expected)
+		if err == nil {
+			err = reflectReadStatm(&cfg, pid, &expected)
+		}
+		if err != nil {
+			t.Errorf("<%d> reflect: %v\n", pid, err)
+			continue
+		}
+		if !reflect.DeepEqual(proc.Stat, expected.Stat) || !reflect.DeepEqual(proc.Statm, expected.Statm) {
+			t.Errorf("<%d> parsers differ:\n%#v\n%#v\n", pid, proc.Stat, expected.Stat)
+			continue
+		}
+		fmt.Printf("ok <%d> parseStat() and parseStatm() match reflection\n", pid)
+	}
+
+	for _, bad := range []string{
+		"1 bash S 0\n",             // no parentheses
+		"1 (bash)",                 // nothing after the command
+		"x (bash) S 0\n",           // bad pid
+		"1 (bash) S 0 1\n2 (sh)\n", // two lines
+		"1 (bash) S 0  1\n",        // empty field
+	} {
+		var proc Proc
+
+		cfg.contents = map[string]string{"stat": bad}
+		err := readStat(&cfg, 1, &proc)
+		if err == nil {
+			t.Errorf("readStat(%q): expected an error\n", bad)
+			continue
+		}
+		fmt.Printf("ok readStat(%q) fails: %v\n", bad, err)
+	}
+
+	cfg.contents = map[string]string{"statm": "1 2 3\n"}
+	err := readStatm(&cfg, 1, &Proc{})
+	if err == nil {
+		t.Errorf("readStatm(short): expected an error\n")
+	} else {
+		fmt.Printf("ok readStatm(short) fails: %v\n", err)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+
+	statuses := map[uint64]string{0: currentStatusContent}
+	for pid, tc := range testCases {
+		statuses[pid] = tc.statusContent
+	}
+	for pid, content := range statuses {
+		var proc, expected Proc
+
+		cfg.contents = map[string]string{"status": content}
+		err := readStatus(&cfg, pid, &proc)
+		if err != nil {
+			t.Errorf("<%d> %v\n", pid, err)
+			continue
+		}
+		err = reflectReadStatus(&cfg, pid, &expected)
+		if err != nil {
+			t.Errorf("<%d> reflect: %v\n", pid, err)
+			continue
+		}
+		if !reflect.DeepEqual(proc.Status, expected.Status) {
+			t.Errorf("<%d> parsers differ:\n%#v\n%#v\n", pid, proc.Status, expected.Status)
+			continue
+		}
+		fmt.Printf("ok <%d> parseStatus() matches reflection\n", pid)
+	}
+
+	for _, bad := range []string{
+		"Uid:\t0\t0\t0\n",
+		"Uid:\t0\t0\t0\t0\t0\n",
+		"SigQ:\t0\n",
+		"Groups:\t4 x\n",
+		"VmRSS:\t12 MB\n",
+	} {
+		var proc Proc
+
+		cfg.contents = map[string]string{"status": bad}
+		err := readStatus(&cfg, 1, &proc)
+		if !errors.Is(err, ErrParse) {
+			t.Errorf("readStatus(%q): expected ErrParse, got %v\n", bad, err)
+			continue
+		}
+		fmt.Printf("ok readStatus(%q) fails: %v\n", bad, err)
+	}
+}
+
+func benchmarkRead(b *testing.B, read func(cfg *procConfig, pid uint64, proc *Proc) error) {
+	var cfg procConfig
+	var proc Proc
+
+	// real files (without caching), as an agent reads them, but the same
+	// ones every time
+	dir := b.TempDir()
+	tc := testCases[15220]
+	files := map[string]string{
+		"stat":   tc.statContent,
+		"statm":  tc.statmContent,
+		"status": tc.statusContent,
+	}
+	err := os.Mkdir(filepath.Join(dir, "15220"), 0755)
+	for name, contents := range files {
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "15220", name), []byte(contents), 0644)
+		}
+	}
+	if err != nil {
+		b.Fatalf("WriteFile(): %v\n", err)
+	}
+	cfg.fsys = dirFS(dir)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := read(&cfg, 15220, &proc)
+		if err != nil {
+			b.Fatalf("%v\n", err)
+		}
+	}
+}
+
+func BenchmarkReadStat(b *testing.B) {
+	benchmarkRead(b, readStat)
+}
+
+func BenchmarkReadStatReflect(b *testing.B) {
+	benchmarkRead(b, reflectReadStat)
+}
+
+func BenchmarkReadStatm(b *testing.B) {
+	benchmarkRead(b, readStatm)
+}
+
+func BenchmarkReadStatmReflect(b *testing.B) {
+	benchmarkRead(b, reflectReadStatm)
+}
+
+func BenchmarkReadStatus(b *testing.B) {
+	benchmarkRead(b, readStatus)
+}
+
+func BenchmarkReadStatusReflect(b *testing.B) {
+	benchmarkRead(b, reflectReadStatus)
+}
+
+func benchmarkParse(b *testing.B, read func(cfg *procConfig, pid uint64, proc *Proc) error) {
+	var cfg procConfig
+	var proc Proc
+
+	// just the parsing, from the copy in contents
+	tc := testCases[15220]
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{"stat": tc.statContent}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := read(&cfg, 15220, &proc)
+		if err != nil {
+			b.Fatalf("%v\n", err)
+		}
+	}
+}
+
+func BenchmarkParseStat(b *testing.B) {
+	benchmarkParse(b, readStat)
+}
+
+func BenchmarkParseStatReflect(b *testing.B) {
+	benchmarkParse(b, reflectReadStat)
+}
@@ -4,31 +4,130 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"reflect"
-	"runtime"
+	"io/fs"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync/atomic"
+	"syscall"
 )
 
 type procConfig struct {
-	basepath string
+	fsys     fs.FS
+	devfs    fs.FS  // /dev, for resolving tty names, nil for none
+	fields   Field  // what readProc() reads, 0 means AllFields
+	partial  bool   // readProc() carries on after errors, see Partial()
+	buf      []byte // reused by readBuffer()
+	workers  int    // for ReadAll(), 0 means runtime.GOMAXPROCS(0)
 	contents map[string]string
+
+	ttyDrivers *ttyDriverCache // shared by a Reader's configs, nil to read each time
 }
 
-// All errors returned should be type ProcErr and include a stack
+// All errors returned should be type ProcErr (except PartialErr, whose Errors
+// are), with where they came from when it's known
 type ProcErr struct {
 	error
 	Message string
-	Stack   []byte
+	Stack   []byte // only with CaptureStacks(true)
+
+	Pid   uint64 // 0 if it isn't about a process
+	File  string // relative to the proc filesystem, eg. "stat", "attr/current" or "uptime"
+	Field string // from a ParseErr, eg. "Utime"
 }
 
 func (f *ProcErr) Error() string {
 	return fmt.Sprintf("procreader: %s", f.Message)
 }
 
+// Unwrap returns the underlying error, for errors.Is() and errors.As().
+func (f *ProcErr) Unwrap() error {
+	return f.error
+}
+
+var (
+	// ErrProcessGone matches errors from ReadProc() when the process exited
+	// while (or before) it was read, eg. after ListPids() returned it.
+	ErrProcessGone = errors.New("process has exited")
+
+	// ErrPermission matches errors from files we aren't allowed to read, eg.
+	// environ of other users' processes. It is fs.ErrPermission.
+	ErrPermission = fs.ErrPermission
+
+	// ErrParse matches errors from files we couldn't parse, use errors.As()
+	// with a *ParseErr for where.
+	ErrParse = errors.New("parse error")
+)
+
+// ParseErr describes what couldn't be parsed.
+type ParseErr struct {
+	File  string // eg. "stat" or "status"
+	Line  int    // starting from 1, 0 if it's not about a particular line
+	Field string // eg. "Utime" or "Uid", "" if it's not about a particular field
+	Err   error  // what went wrong, eg. a *strconv.NumError
+}
+
+func (f *ParseErr) Error() string {
+	msg := "parsing " + f.File
+	if f.Line > 0 {
+		msg += fmt.Sprintf(" line %d", f.Line)
+	}
+	if f.Field != "" {
+		msg += " field " + f.Field
+	}
+	return fmt.Sprintf("%s: %v", msg, f.Err)
+}
+
+func (f *ParseErr) Unwrap() error {
+	return f.Err
+}
+
+func (f *ParseErr) Is(target error) bool {
+	return target == ErrParse
+}
+
+// PartialErr is returned along with the rest of the Proc when reading with
+// Partial() and some of the files couldn't be read. Errors is keyed by the
+// file name: "stat", "statm", "status", "cmdline", "environ", "attr" or
+// "loginuid" (which also covers sessionid).
+type PartialErr struct {
+	Errors map[string]error
+}
+
+func (f *PartialErr) Error() string {
+	var msgs []string
+
+	for _, name := range f.Files() {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, f.Errors[name]))
+	}
+
+	return fmt.Sprintf("procreader: failed to read %s", strings.Join(msgs, "; "))
+}
+
+// Files returns the names of the files that couldn't be read, sorted.
+func (f *PartialErr) Files() []string {
+	var names []string
+
+	for name := range f.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Unwrap returns the individual errors, for errors.Is() and errors.As().
+func (f *PartialErr) Unwrap() []error {
+	var errs []error
+
+	for _, name := range f.Files() {
+		errs = append(errs, f.Errors[name])
+	}
+
+	return errs
+}
+
 /*
  * Fields from https://www.kernel.org/doc/Documentation/filesystems/proc.txt
  * See also: https://gitorious.org/procps/procps/source/3a66fba1e934cbd830df572d8d03c05b4f4a5f1e:proc/readproc.c#L550
@@ -162,17 +261,108 @@ type Status_t struct {
 	Nonvoluntary_ctxt_switches uint64   // number of non voluntary context switches
 }
 
+// SecurityContext is the LSM label of a process. It isn't read by default, as
+// that's several extra files per process, so ask for it with eg.
+// ReadProc(pid, Fields(AllFields|Security)); otherwise it's left zero.
+type SecurityContext struct {
+	// fields from /proc/<pid>/attr/{current,exec,prev} (or the LSM-specific
+	// /proc/<pid>/attr/<lsm>/ versions of those files)
+
+	LSM     string // LSM that provided the labels ("selinux", "apparmor", "smack" or "" if none)
+	Current string // current security context of the process
+	Exec    string // context to be used on the next execve (usually empty)
+	Prev    string // context before the last execve
+	Mode    string // AppArmor profile mode (eg. "enforce" or "complain"), "" for other LSMs
+	Read    bool   // whether the files were read, as they're only read when asked for
+}
+
 type Proc struct {
-	Stat   Stat_t
-	Statm  Statm_t
-	Status Status_t
+	Stat     Stat_t
+	Statm    Statm_t
+	Status   Status_t
+	Security SecurityContext // only with Fields(... | Security)
+
+	// LoginUid and SessionId are from /proc/<pid>/{loginuid,sessionid}
+	LoginUid  uint64 // audit login UID, survives su/sudo (AuditUnset if never logged in)
+	SessionId uint64 // audit session ID (AuditUnset if never logged in)
 
 	// Environ and Cmdline are from /proc/<pid>/{environ,cmdline}
 	Cmdline []string
 	Environ []string
 }
 
+// Value of LoginUid and SessionId for processes which weren't started from a
+// login session (eg. daemons started at boot) or on kernels without audit.
+const AuditUnset uint64 = 4294967295
+
+// Field selects parts of a Proc to read, so that only their files are opened.
+type Field uint
+
+const (
+	Stat     Field = 1 << iota // Proc.Stat from /proc/<pid>/stat
+	Statm                      // Proc.Statm from /proc/<pid>/statm
+	Status                     // Proc.Status from /proc/<pid>/status
+	Cmdline                    // Proc.Cmdline from /proc/<pid>/cmdline
+	Environ                    // Proc.Environ from /proc/<pid>/environ
+	Security                   // Proc.Security from /proc/<pid>/attr/
+	AuditIds                   // Proc.LoginUid and SessionId from /proc/<pid>/{loginuid,sessionid}
+
+	// what's read by default. Security and AuditIds aren't, as they're four
+	// or more extra files per process, so ask for them with eg.
+	// Fields(AllFields | Security).
+	AllFields = Stat | Statm | Status | Cmdline | Environ
+)
+
+// ReadOption changes how ReadProc() reads a process.
+type ReadOption func(cfg *procConfig)
+
+//
+// This function returns a ReadOption which only reads the specified fields,
+// eg. Fields(Stat|Cmdline). The rest of the Proc is left zero.
+//
+func Fields(fields Field) ReadOption {
+	return func(cfg *procConfig) {
+		cfg.fields = fields
+	}
+}
+
+//
+// This function returns a ReadOption which keeps going when a file can't be
+// read (eg. environ of another user's process), returning what could be read
+// along with a *PartialErr. If the process has exited, the error matches
+// ErrProcessGone as without Partial().
+//
+func Partial() ReadOption {
+	return func(cfg *procConfig) {
+		cfg.partial = true
+	}
+}
+
+//
+// This function returns a ReadOption which stops ReadProcData() keeping a copy
+// of the files it reads, so it returns a nil map.
+//
+func NoContents() ReadOption {
+	return func(cfg *procConfig) {
+		cfg.contents = nil
+	}
+}
+
+// whether wrapError() records the stack, see CaptureStacks()
+var captureStacks atomic.Bool
+
+//
+// This function turns capturing the stack of the goroutine creating each
+// ProcErr on or off (the default). It's for debugging, as errors are common
+// (processes exit while being read) and capturing stacks isn't cheap.
+//
+func CaptureStacks(on bool) {
+	captureStacks.Store(on)
+}
+
 func wrapError(err error) error {
+	var parseErr *ParseErr
+
 	if err == nil {
 		return nil
 	}
@@ -181,123 +371,166 @@ func wrapError(err error) error {
 		return e
 	}
 
-	trace := make([]byte, 4096)
-	runtime.Stack(trace, true)
-
-	return &ProcErr{
+	e := &ProcErr{
 		error:   err,
 		Message: err.Error(),
-		Stack:   trace,
 	}
+	if errors.As(err, &parseErr) {
+		e.File = parseErr.File
+		e.Field = parseErr.Field
+	}
+	if captureStacks.Load() {
+		e.Stack = debug.Stack()
+	}
+
+	return e
+}
+
+// withContext returns err as a ProcErr with the pid and file it came from, if
+// they aren't already set.
+func withContext(err error, pid uint64, file string) error {
+	if err == nil {
+		return nil
+	}
+
+	e := wrapError(err).(*ProcErr)
+	if e.Pid == 0 {
+		e.Pid = pid
+	}
+	if e.File == "" {
+		e.File = file
+	}
+
+	return e
 }
 
 func newError(format string, args ...interface{}) error {
 	return wrapError(errors.New(fmt.Sprintf(format, args...)))
 }
 
-// readLines reads a whole file into memory
-// and returns a slice of its lines.
-func readLines(cfg *procConfig, pid uint64, filename string) ([]string, error) {
-	var lines []string
-	var scanner *bufio.Scanner
+// parseError returns a ParseErr (matching ErrParse) for field on line of file.
+func parseError(file string, line int, field string, err error) error {
+	return wrapError(&ParseErr{File: file, Line: line, Field: field, Err: err})
+}
 
-	if contents, ok := cfg.contents[filename]; ok {
-		scanner = bufio.NewScanner(strings.NewReader(contents))
-	} else {
-		fn := fmt.Sprintf("%s/%d/%s", cfg.basepath, pid, filename)
-		data, err := ioutil.ReadFile(fn)
-		if err != nil {
-			return nil, wrapError(err)
+// atLine sets the line of the ParseErr in err (if there is one) to line, for
+// parsers that are given one line at a time.
+func atLine(err error, line int) error {
+	var parseErr *ParseErr
+
+	if errors.As(err, &parseErr) && parseErr.Line == 0 {
+		parseErr.Line = line
+		if e, ok := err.(*ProcErr); ok {
+			e.Message = e.error.Error()
 		}
-		// for generating test cases, having the input is required
-		cfg.contents[filename] = string(data)
-		scanner = bufio.NewScanner(strings.NewReader(cfg.contents[filename]))
 	}
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	return err
+}
+
+// goneError marks err, from reading a file of pid, as ErrProcessGone.
+func goneError(pid uint64, err error) error {
+	gone := *withContext(err, pid, "").(*ProcErr)
+	gone.error = fmt.Errorf("%w: %w", ErrProcessGone, gone.error)
+	gone.Message = fmt.Sprintf("process %d has exited: %s", pid, gone.Message)
+
+	return &gone
+}
+
+// pidError returns err, from reading the files of pid, as ErrProcessGone if
+// the process has exited. It's for the readers of files outside of ReadProc().
+func pidError(cfg *procConfig, pid uint64, err error) error {
+	if err == nil {
+		return nil
+	}
+	// 0 is for the system-wide files, eg. /proc/net/dev
+	if pid != 0 && processGone(cfg, pid, err) {
+		return goneError(pid, err)
 	}
+	return wrapError(err)
+}
 
-	return lines, wrapError(scanner.Err())
+// processGone returns true if err, from reading a file of pid, is because the
+// process has exited: the kernel says so (ESRCH) or <pid> no longer exists.
+func processGone(cfg *procConfig, pid uint64, err error) bool {
+	if errors.Is(err, syscall.ESRCH) {
+		return true
+	}
+	if !isUnavailable(err) {
+		return false
+	}
+	_, err = fs.Stat(cfg.fsys, strconv.FormatUint(pid, 10))
+
+	return err != nil && isUnavailable(err)
 }
 
-func readStat(cfg *procConfig, pid uint64, proc *Proc) error {
-	var stat Stat_t
+// readContents returns the contents of <filename> in cfg.fsys, or the copy
+// stored in cfg.contents under key if we already have one.
+func readContents(cfg *procConfig, key string, filename string) (string, error) {
+	if contents, ok := cfg.contents[key]; ok {
+		return contents, nil
+	}
 
-	lines, err := readLines(cfg, pid, "stat")
+	data, err := readFile(cfg, filename)
 	if err != nil {
-		return wrapError(err)
+		return "", wrapError(err)
 	}
-	if len(lines) != 1 {
-		return newError("readStat(): expected 1 line, got %d", len(lines))
+	// for generating test cases, having the input is required
+	if cfg.contents != nil {
+		cfg.contents[key] = string(data)
 	}
 
-	s := reflect.ValueOf(&stat).Elem()
-	typeOfS := s.Type()
+	return string(data), nil
+}
 
-	// field[1] is special in that it's '(<command>)' and we need to
-	// watch out for things like ')' in the <command>. We do what
-	// procps does and take everything between the first '(' and
-	// last ')'
-	cmd_end := strings.LastIndex(lines[0], ")")
-	cmd_start := strings.Index(lines[0], "(") + 1
+// splitLines returns a slice of the lines in contents.
+func splitLines(contents string) ([]string, error) {
+	var lines []string
 
-	// This mess:
-	//
-	//   * splits all the fields *after* the command
-	//   * prepends the first field (Pid) and command (w/ '()' removed)
-	//
-	fields := strings.Split(lines[0][cmd_end+2:], " ")
-	fields = append([]string{lines[0][0 : cmd_start-1],
-		lines[0][cmd_start:cmd_end]}, fields...)
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
 
-	// loop through the struct's fields and add them to 'stat'
-	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
+	return lines, wrapError(scanner.Err())
+}
 
-		if !f.CanSet() {
-			continue
-		}
+// readLines reads a whole file into memory
+// and returns a slice of its lines.
+func readLines(cfg *procConfig, pid uint64, filename string) ([]string, error) {
+	contents, err := readContents(cfg, filename, fmt.Sprintf("%d/%s", pid, filename))
+	if err != nil {
+		return nil, withContext(err, pid, filename)
+	}
 
-		// Older kernels are missing newer fields
-		if i >= len(fields) {
-			continue
-		}
+	return splitLines(contents)
+}
 
-		//fmt.Printf("%d: %s %s = '%s'\n", i,
-		//typeOfS.Field(i).Name, f.Type(), fields[i])
+// readSystemLines is readLines for files that are not per-process, eg.
+// /proc/uptime. These are stored in cfg.contents with a leading '/' so
+// they can't be confused with the per-process files.
+func readSystemLines(cfg *procConfig, filename string) ([]string, error) {
+	contents, err := readContents(cfg, "/"+filename, filename)
+	if err != nil {
+		return nil, withContext(err, 0, filename)
+	}
 
-		switch f.Type().String() {
-		case "int32":
-			u, err := strconv.ParseInt(strings.TrimSpace(fields[i]), 10, 32)
-			if err != nil {
-				return wrapError(err)
-			}
-			s.Field(i).SetInt(u)
-		case "int64":
-			u, err := strconv.ParseInt(strings.TrimSpace(fields[i]), 10, 64)
-			if err != nil {
-				return wrapError(err)
-			}
-			s.Field(i).SetInt(u)
-		case "uint32":
-			u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 32)
-			if err != nil {
-				return wrapError(err)
-			}
-			s.Field(i).SetUint(u)
-		case "uint64":
-			u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 64)
-			if err != nil {
-				return wrapError(err)
-			}
-			s.Field(i).SetUint(u)
-		case "string":
-			s.Field(i).SetString(fields[i])
+	return splitLines(contents)
+}
 
-		default:
-			return newError("readStat(): unhandled type '%s' for '%s'",
-				f.Type().String(), typeOfS.Field(i).Name)
-		}
+func readStat(cfg *procConfig, pid uint64, proc *Proc) error {
+	var stat Stat_t
+
+	data, err := readBuffer(cfg, pid, "stat")
+	if err != nil {
+		return wrapError(err)
+	}
+	line, err := singleLine("stat", data)
+	if err != nil {
+		return wrapError(err)
+	}
+	err = parseStat(line, &stat)
+	if err != nil {
+		return wrapError(err)
 	}
 
 	proc.Stat = stat
@@ -307,199 +540,225 @@ func readStat(cfg *procConfig, pid uint64, proc *Proc) error {
 func readStatm(cfg *procConfig, pid uint64, proc *Proc) error {
 	var statm Statm_t
 
-	lines, err := readLines(cfg, pid, "statm")
+	data, err := readBuffer(cfg, pid, "statm")
 	if err != nil {
 		return wrapError(err)
 	}
-	if len(lines) != 1 {
-		return newError("readStatm(): expected 1 line, got %d", len(lines))
+	line, err := singleLine("statm", data)
+	if err != nil {
+		return wrapError(err)
+	}
+	err = parseStatm(line, &statm)
+	if err != nil {
+		return wrapError(err)
 	}
 
-	s := reflect.ValueOf(&statm).Elem()
-	typeOfS := s.Type()
+	proc.Statm = statm
+	return nil
+}
 
-	fields := strings.Split(lines[0], " ")
+func readStatus(cfg *procConfig, pid uint64, proc *Proc) error {
+	var status Status_t
 
-	// loop through the struct's fields and add them to 'statm'
-	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
+	contents, err := readString(cfg, pid, "status")
+	if err != nil {
+		return wrapError(err)
+	}
+	// reuse the caller's slice, see ReadProcInto()
+	status.Groups = proc.Status.Groups[:0]
 
-		if !f.CanSet() {
-			continue
-		}
+	err = parseStatus(contents, &status)
+	if err != nil {
+		return wrapError(err)
+	}
+	proc.Status = status
 
-		// fmt.Printf("%d: %s %s = '%s'\n", i,
-		//		typeOfS.Field(i).Name, f.Type(), fields[i])
+	return nil
+}
 
-		switch f.Type().String() {
-		case "uint64":
-			u, err := strconv.ParseUint(strings.TrimSpace(fields[i]), 10, 64)
-			if err != nil {
-				return wrapError(err)
-			}
-			s.Field(i).SetUint(u)
-		default:
-			return newError("readStatm(): unhandled type '%s' for '%s'",
-				f.Type().String(), typeOfS.Field(i).Name)
-		}
+// readNullSeparated appends the strings in <pid>/<filename> to strs, so the
+// caller can reuse its slice.
+func readNullSeparated(cfg *procConfig, pid uint64, filename string, strs []string) ([]string, error) {
+	contents, err := readString(cfg, pid, filename)
+	if err != nil {
+		return strs, wrapError(err)
 	}
 
-	proc.Statm = statm
-	return nil
+	return splitNull(strs, contents), nil
 }
 
-func readStatus(cfg *procConfig, pid uint64, proc *Proc) error {
+func readCmdline(cfg *procConfig, pid uint64, proc *Proc) error {
 	var err error
-	var statusMap = make(map[string]reflect.Value)
-	var status Status_t
+	proc.Cmdline, err = readNullSeparated(cfg, pid, "cmdline", proc.Cmdline[:0])
+	return wrapError(err)
+}
+
+func readEnviron(cfg *procConfig, pid uint64, proc *Proc) error {
+	var err error
+	proc.Environ, err = readNullSeparated(cfg, pid, "environ", proc.Environ[:0])
+	return wrapError(err)
+}
+
+// isUnavailable returns true if err means the file doesn't exist (eg. the
+// kernel was built without the feature, or the process exited) or, for attr
+// files, that there's no LSM providing it (the kernel returns EINVAL in that
+// case).
+func isUnavailable(err error) bool {
+	var pathErr *fs.PathError
+
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ESRCH) {
+		return true
+	}
+	if errors.As(err, &pathErr) && pathErr.Err == syscall.EINVAL {
+		return true
+	}
+	return false
+}
 
-	lines, err := readLines(cfg, pid, "status")
+// isPermission returns true if err means we weren't allowed to read the file,
+// eg. /proc/<pid>/environ of another user's process.
+func isPermission(err error) bool {
+	return errors.Is(err, ErrPermission)
+}
+
+// readAttr returns the value from /proc/<pid>/attr/<filename> with the
+// trailing NUL and newline removed, or "" if it is unavailable.
+func readAttr(cfg *procConfig, pid uint64, filename string) (string, bool, error) {
+	lines, err := readLines(cfg, pid, "attr/"+filename)
 	if err != nil {
-		return wrapError(err)
+		if isUnavailable(err) {
+			return "", false, nil
+		}
+		return "", false, wrapError(err)
 	}
 
-	s := reflect.ValueOf(&status).Elem()
-	typeOfS := s.Type()
-	for i := 0; i < s.NumField(); i++ {
-		statusMap[typeOfS.Field(i).Name] = s.Field(i)
-	}
-
-	for line := range lines {
-		fields := strings.SplitN(lines[line], ":\t", 2)
-		name := fields[0]
-		value := strings.TrimSpace(fields[1])
-
-		f := statusMap[name]
-		if !f.IsValid() {
-			// not valid, see if capitalizing first character fixes
-			a := []rune(name)
-			a[0] = unicode.ToUpper(a[0])
-			name = string(a)
-
-			f = statusMap[name]
-			if !f.IsValid() {
-				// still not valid, can't move forward, though we'll skip fields we know
-				// exist on older kernels that we don't care about any more.
-				switch fields[0] {
-				case "SleepAVG":
-					continue
-				}
-				return newError("readStatus(): '%s' is unhandled", fields[0])
-			}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\000\n "), true, nil
+}
+
+func readSecurity(cfg *procConfig, pid uint64, proc *Proc) error {
+	var sec SecurityContext
+	var prefix string
+
+	// Newer kernels have per-LSM directories so more than one LSM can be
+	// active. Check for those first, then fall back to the shared files.
+	for _, lsm := range []string{"apparmor", "smack"} {
+		_, ok, err := readAttr(cfg, pid, lsm+"/current")
+		if err != nil {
+			return wrapError(err)
+		}
+		if ok {
+			sec.LSM = lsm
+			prefix = lsm + "/"
+			break
 		}
+	}
 
-		switch f.Type().String() {
-		case "procreader.Ids":
-			if name == "Uid" {
-				cnt, err := fmt.Sscanf(value, "%d\t%d\t%d\t%d",
-					&status.Uid.Real, &status.Uid.Effective,
-					&status.Uid.Saved, &status.Uid.FS,
-				)
-				if err != nil {
-					return wrapError(err)
-				}
-				if cnt != 4 {
-					return newError("readStatus(Uid): expected 4 fields, got %d: '%s'", cnt, value)
-				}
-			} else if name == "Gid" {
-				cnt, err := fmt.Sscanf(value, "%d\t%d\t%d\t%d",
-					&status.Gid.Real, &status.Gid.Effective,
-					&status.Gid.Saved, &status.Gid.FS,
-				)
-				if err != nil {
-					return wrapError(err)
-				}
-				if cnt != 4 {
-					return newError("readStatus(Gid): expected 4 fields, got %d: '%s'", cnt, value)
-				}
-			} else {
-				return newError("readStatus: Internal Error: %s not supported for type Ids", name)
-			}
-		case "procreader.SigQVal":
-			cnt, err := fmt.Sscanf(value, "%d/%d", &status.SigQ.Num, &status.SigQ.Max)
-			if err != nil {
-				return wrapError(err)
-			}
-			if cnt != 2 {
-				return newError("readStatus[%s]: expected 2 fields, got %d: '%s'", name, cnt, value)
-			}
-		case "[]uint64":
-			if name != "Groups" {
-				return newError("readStatus: Internal Error: %s not supported for type []uint64", name)
-			}
-			groups := strings.Split(value, " ")
-			for g := range groups {
-				if len(groups[g]) == 0 {
-					continue
-				}
-				val, err := strconv.ParseUint(groups[g], 10, 64)
-				if err != nil {
-					return wrapError(err)
-				}
-				status.Groups = append(status.Groups, val)
-			}
-		case "string":
-			f.SetString(value)
-		case "uint64":
-			if strings.HasSuffix(value, " kB") {
-				value = value[:len(value)-3]
-			}
-			u, err := strconv.ParseUint(value, 10, 64)
-			if err != nil {
-				return wrapError(err)
-			}
-			f.SetUint(u)
-		default:
-			return newError("readStatus(): unhandled type '%s' for '%s'", f.Type().String(), name)
+	current, _, err := readAttr(cfg, pid, prefix+"current")
+	if err != nil {
+		return wrapError(err)
+	}
+	exec, _, err := readAttr(cfg, pid, prefix+"exec")
+	if err != nil {
+		return wrapError(err)
+	}
+	prev, _, err := readAttr(cfg, pid, prefix+"prev")
+	if err != nil {
+		return wrapError(err)
+	}
+	sec.Current = current
+	sec.Exec = exec
+	sec.Prev = prev
+
+	if sec.LSM == "" && sec.Current != "" {
+		// SELinux contexts are 'user:role:type[:level]', AppArmor's are
+		// 'unconfined' or '<profile> (<mode>)'
+		if sec.Current == "unconfined" || strings.HasSuffix(sec.Current, ")") {
+			sec.LSM = "apparmor"
+		} else if strings.Count(sec.Current, ":") >= 2 {
+			sec.LSM = "selinux"
 		}
 	}
 
-	proc.Status = status
+	if sec.LSM == "apparmor" && strings.HasSuffix(sec.Current, ")") {
+		idx := strings.LastIndex(sec.Current, " (")
+		if idx != -1 {
+			sec.Mode = sec.Current[idx+2 : len(sec.Current)-1]
+		}
+	}
 
+	sec.Read = true
+	proc.Security = sec
 	return nil
 }
 
-func readNullSeparated(cfg *procConfig, pid uint64, filename string) ([]string, error) {
-	var r *bufio.Reader
-	var strs []string
+// Unconfined returns true if the process is not confined by any LSM policy.
+// As Security isn't read by default, it returns false unless the Proc was read
+// with eg. Fields(AllFields | Security), since there's no telling without.
+func (sec *SecurityContext) Unconfined() bool {
+	if !sec.Read {
+		return false
+	}
+	switch sec.LSM {
+	case "":
+		return true
+	case "apparmor":
+		return sec.Current == "unconfined" || sec.Mode == "unconfined"
+	case "selinux":
+		fields := strings.Split(sec.Current, ":")
+		return len(fields) >= 3 && (fields[2] == "unconfined_t" ||
+			fields[2] == "unconfined_service_t")
+	}
+	return false
+}
 
-	if contents, ok := cfg.contents[filename]; ok {
-		r = bufio.NewReader(strings.NewReader(contents))
-	} else {
-		fn := fmt.Sprintf("%s/%d/%s", cfg.basepath, pid, filename)
-		data, err := ioutil.ReadFile(fn)
-		if err != nil {
-			return nil, wrapError(err)
+// readAuditId reads a single audit ID from /proc/<pid>/<filename>, returning
+// AuditUnset if the kernel doesn't have the file.
+func readAuditId(cfg *procConfig, pid uint64, filename string) (uint64, error) {
+	lines, err := readLines(cfg, pid, filename)
+	if err != nil {
+		// kernels without CONFIG_AUDIT don't have it, but then neither
+		// does a process that's exited
+		if errors.Is(err, fs.ErrNotExist) && !processGone(cfg, pid, err) {
+			return AuditUnset, nil
 		}
-		// for generating test cases, having the input is required
-		cfg.contents[filename] = string(data)
-		r = bufio.NewReader(strings.NewReader(cfg.contents[filename]))
+		return 0, wrapError(err)
+	}
+	if len(lines) != 1 {
+		return 0, parseError(filename, 0, "", fmt.Errorf("expected 1 line, got %d", len(lines)))
 	}
 
-	for {
-		str, err := r.ReadString(0)
-		if err == io.EOF {
-			// do something here
-			break
-		} else if err != nil {
-			return nil, wrapError(err)
-		}
-		strs = append(strs, strings.TrimRight(str, "\000"))
+	id, err := strconv.ParseUint(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return 0, parseError(filename, 1, "", err)
 	}
 
-	return strs, nil
+	return id, nil
 }
 
-func readCmdline(cfg *procConfig, pid uint64, proc *Proc) error {
+func readAuditIds(cfg *procConfig, pid uint64, proc *Proc) error {
 	var err error
-	proc.Cmdline, err = readNullSeparated(cfg, pid, "cmdline")
+
+	proc.LoginUid, err = readAuditId(cfg, pid, "loginuid")
+	if err != nil {
+		return wrapError(err)
+	}
+	proc.SessionId, err = readAuditId(cfg, pid, "sessionid")
 	return wrapError(err)
 }
 
-func readEnviron(cfg *procConfig, pid uint64, proc *Proc) error {
-	var err error
-	proc.Environ, err = readNullSeparated(cfg, pid, "environ")
-	return wrapError(err)
+// the files readProc() reads for each Field, in order
+var procFiles = []struct {
+	field Field
+	name  string
+	read  func(cfg *procConfig, pid uint64, proc *Proc) error
+}{
+	{Stat, "stat", readStat},
+	{Statm, "statm", readStatm},
+	{Status, "status", readStatus},
+	{Cmdline, "cmdline", readCmdline},
+	{Environ, "environ", readEnviron},
+	{Security, "attr", readSecurity},
+	{AuditIds, "loginuid", readAuditIds},
 }
 
 //
@@ -508,49 +767,269 @@ func readEnviron(cfg *procConfig, pid uint64, proc *Proc) error {
 // is mostly done to make this module more testable.
 //
 func readProc(cfg *procConfig, pid uint64) (Proc, error) {
-	var err error
 	var proc Proc
 
-	err = readStat(cfg, pid, &proc)
-	if err != nil {
-		return proc, wrapError(err)
+	err := readProcInto(cfg, pid, &proc)
+
+	return proc, err
+}
+
+// how many times readProcInto() tries when the PID keeps being reused
+const maxReadAttempts = 3
+
+// readProcInto is readProc() into proc, reusing the memory of its slices.
+//
+// The process can exit while we're reading its files and another be given its
+// PID, which would mix the two in proc. So the start time in <pid>/stat is
+// compared before and after the other files, and if it changed they're read
+// again, from the new process. stat is the first file read, so when it's one
+// of cfg.fields it gives the "before" time; otherwise just the start time is
+// read from it. If the PID is still being reused after maxReadAttempts (or the
+// process has exited by the end), it's ErrProcessGone. Start times are in
+// clock ticks, so a PID reused within one tick isn't noticed, but the kernel
+// doesn't reuse PIDs that quickly without a lot of processes being created.
+func readProcInto(cfg *procConfig, pid uint64, proc *Proc) error {
+	fields := cfg.fields
+	if fields == 0 {
+		fields = AllFields
 	}
-	err = readStatm(cfg, pid, &proc)
-	if err != nil {
-		return proc, wrapError(err)
+
+	// there's nothing to check when stat is the only file read, or when
+	// the files are given in cfg.contents (eg. by tests) rather than read
+	_, canned := cfg.contents["stat"]
+	if canned || fields&^Stat == 0 {
+		return readProcFiles(cfg, pid, proc)
 	}
-	err = readStatus(cfg, pid, &proc)
+
+	for attempt := 0; attempt < maxReadAttempts; attempt++ {
+		var before uint64
+		var partial *PartialErr
+		var err error
+
+		// what we kept of the old process' files would be read again
+		for key := range cfg.contents {
+			delete(cfg.contents, key)
+		}
+
+		if fields&Stat == 0 {
+			before, err = readStartTime(cfg, pid)
+			if err != nil {
+				return identityError(cfg, pid, err)
+			}
+		}
+		err = readProcFiles(cfg, pid, proc)
+		if err != nil && !errors.As(err, &partial) {
+			return err
+		}
+		if fields&Stat != 0 {
+			if partial != nil && partial.Errors["stat"] != nil {
+				// without a start time, there's nothing to compare
+				return err
+			}
+			before = proc.Stat.Start_time
+		}
+
+		after, startErr := readStartTime(cfg, pid)
+		if startErr != nil {
+			return identityError(cfg, pid, startErr)
+		}
+		if after == before {
+			return err
+		}
+	}
+
+	return goneError(pid, newError("pid reused %d times while being read", maxReadAttempts))
+}
+
+// identityError returns err, from readStartTime(), as ErrProcessGone if it
+// means the process has exited.
+func identityError(cfg *procConfig, pid uint64, err error) error {
+	if processGone(cfg, pid, err) {
+		return goneError(pid, err)
+	}
+	return withContext(err, pid, "stat")
+}
+
+// readStartTime returns Start_time from <pid>/stat, which (with the PID)
+// identifies the process. It's always read from the file, as it's for checking
+// the process hasn't changed since the copy in cfg.contents.
+func readStartTime(cfg *procConfig, pid uint64) (uint64, error) {
+	fresh := *cfg
+	fresh.contents = nil
+
+	data, err := readBuffer(&fresh, pid, "stat")
+	cfg.buf = fresh.buf
 	if err != nil {
-		return proc, wrapError(err)
+		return 0, wrapError(err)
 	}
-	err = readCmdline(cfg, pid, &proc)
+	line, err := singleLine("stat", data)
 	if err != nil {
-		return proc, wrapError(err)
+		return 0, wrapError(err)
 	}
-	err = readEnviron(cfg, pid, &proc)
+
+	return parseStartTime(line)
+}
+
+// readProcFiles reads the files for cfg.fields into proc, see readProcInto().
+func readProcFiles(cfg *procConfig, pid uint64, proc *Proc) error {
+	var failed map[string]error
+
+	groups, cmdline, environ := proc.Status.Groups[:0], proc.Cmdline[:0], proc.Environ[:0]
+	*proc = Proc{}
+	proc.Status.Groups, proc.Cmdline, proc.Environ = groups, cmdline, environ
+
+	fields := cfg.fields
+	if fields == 0 {
+		fields = AllFields
+	}
+
+	for _, file := range procFiles {
+		if fields&file.field == 0 {
+			continue
+		}
+		err := file.read(cfg, pid, proc)
+		if err == nil {
+			continue
+		}
+		if processGone(cfg, pid, err) {
+			return goneError(pid, err)
+		}
+		err = withContext(err, pid, file.name)
+		if !cfg.partial {
+			return err
+		}
+		if failed == nil {
+			failed = make(map[string]error)
+		}
+		failed[file.name] = err
+	}
+
+	if failed != nil {
+		return &PartialErr{Errors: failed}
+	}
+
+	return nil
+}
+
+// readPids returns the PIDs of all processes (the numeric directories at the
+// top of cfg.fsys) in ascending order.
+func readPids(cfg *procConfig) ([]uint64, error) {
+	var pids []uint64
+
+	entries, err := readDir(cfg, ".")
 	if err != nil {
-		return proc, wrapError(err)
+		return nil, wrapError(err)
+	}
+
+	// ReadDir() sorts by name, so we need to sort numerically ourselves
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		pids = append(pids, pid)
 	}
+	sort.Slice(pids, func(i, j int) bool {
+		return pids[i] < pids[j]
+	})
 
-	return proc, nil
+	return pids, nil
+}
+
+//
+// This function returns the PIDs of all processes currently in /proc.
+//
+func ListPids() ([]uint64, error) {
+	return defaultReader.ListPids()
+}
+
+//
+// ListPids returns the PIDs of all processes in r.
+//
+func (r *Reader) ListPids() ([]uint64, error) {
+	cfg := r.config()
+
+	return readPids(&cfg)
 }
 
 //
 // This function reads /proc/<pid>/* files and returns a Proc object
-// which contains the information for the specified process.
+// which contains the information for the specified process. By default all of
+// it is read, pass Fields() to read less. The files are all from the same
+// process: if it exits and the PID is reused while they're being read, they're
+// read again from the new process, or the error matches ErrProcessGone.
+//
+func ReadProc(pid uint64, opts ...ReadOption) (Proc, error) {
+	return defaultReader.ReadProc(pid, opts...)
+}
+
+//
+// ReadProc reads the <pid>/* files in r and returns the Proc.
 //
-func ReadProc(pid uint64) (Proc, error) {
-	proc, _, err := ReadProcData(pid)
+func (r *Reader) ReadProc(pid uint64, opts ...ReadOption) (Proc, error) {
+	var proc Proc
+
+	err := r.ReadProcInto(pid, &proc, opts...)
+
 	return proc, err
 }
 
-func ReadProcData(pid uint64) (Proc, map[string]string, error) {
-	var cfg procConfig
+//
+// This function is ReadProc() into proc, which is reset first but keeps the
+// memory of its Status.Groups, Cmdline and Environ slices for the new values.
+// For reading many processes (or one repeatedly) with few allocations, eg. in
+// an agent. The strings in Cmdline and Environ are new each time, so are safe
+// to keep.
+//
+func ReadProcInto(pid uint64, proc *Proc, opts ...ReadOption) error {
+	return defaultReader.ReadProcInto(pid, proc, opts...)
+}
+
+//
+// ReadProcInto reads the <pid>/* files in r into proc, see ReadProcInto().
+// The buffers for reading the files come from a pool in r.
+//
+func (r *Reader) ReadProcInto(pid uint64, proc *Proc, opts ...ReadOption) error {
+	cfg := r.config()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return r.readProcInto(&cfg, pid, proc)
+}
+
+// readProcInto calls readProcInto() with cfg.buf from r's pool.
+func (r *Reader) readProcInto(cfg *procConfig, pid uint64, proc *Proc) error {
+	buf := r.getBuffer()
+	defer r.putBuffer(buf)
 
-	cfg.basepath = "/proc"
+	cfg.buf = *buf
+	err := readProcInto(cfg, pid, proc)
+	*buf = cfg.buf
+
+	return err
+}
+
+func ReadProcData(pid uint64, opts ...ReadOption) (Proc, map[string]string, error) {
+	return defaultReader.ReadProcData(pid, opts...)
+}
+
+//
+// ReadProcData is ReadProc() that also returns the contents of the files it
+// read, keyed by their name, eg. for generating test cases. Keeping a copy of
+// the contents costs memory, so ReadProc() and ReadProcInto() don't, and
+// neither does ReadProcData() when passed NoContents().
+//
+func (r *Reader) ReadProcData(pid uint64, opts ...ReadOption) (Proc, map[string]string, error) {
+	var proc Proc
+
+	cfg := r.config()
 	cfg.contents = make(map[string]string)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
-	proc, err := readProc(&cfg, pid)
+	err := r.readProcInto(&cfg, pid, &proc)
 
 	return proc, cfg.contents, err
 }
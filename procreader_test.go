@@ -1,9 +1,15 @@
 package procreader
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
+	"testing/fstest"
 )
 
 type testCase struct {
@@ -12,6 +18,9 @@ type testCase struct {
 	statusContent  string
 	cmdlineContent string
 	environContent string
+	attrContent    string // attr/current, "" for none
+	loginuid       string // "" for none, as on kernels without audit
+	sessionid      string
 	expected       Proc
 }
 
@@ -22,13 +31,19 @@ var testCases = map[uint64]testCase{
 		statmContent:   "5355 985 450 239 0 533 0\n",
 		statusContent:  "Name:\tbash\nState:\tS (sleeping)\nTgid:\t15220\nNgid:\t0\nPid:\t15220\nPPid:\t15160\nTracerPid:\t0\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\nFDSize:\t256\nGroups:\t0 \nVmPeak:\t   21480 kB\nVmSize:\t   21420 kB\nVmLck:\t       0 kB\nVmPin:\t       0 kB\nVmHWM:\t    3964 kB\nVmRSS:\t    3940 kB\nVmData:\t    1996 kB\nVmStk:\t     136 kB\nVmExe:\t     956 kB\nVmLib:\t    2288 kB\nVmPTE:\t      60 kB\nVmSwap:\t       0 kB\nThreads:\t1\nSigQ:\t0/3838\nSigPnd:\t0000000000000000\nShdPnd:\t0000000000000000\nSigBlk:\t0000000000010000\nSigIgn:\t0000000000380004\nSigCgt:\t000000004b817efb\nCapInh:\t0000000000000000\nCapPrm:\t0000001fffffffff\nCapEff:\t0000001fffffffff\nCapBnd:\t0000001fffffffff\nSeccomp:\t0\nCpus_allowed:\t3\nCpus_allowed_list:\t0-1\nMems_allowed:\t00000000,00000001\nMems_allowed_list:\t0\nvoluntary_ctxt_switches:\t8367\nnonvoluntary_ctxt_switches:\t7268\n",
 		cmdlineContent: "-bash\x00",
+		attrContent:    "unconfined\n",
+		loginuid:       "0",
+		sessionid:      "7",
 		environContent: "LANG=en_US.UTF-8\x00USER=root\x00LOGNAME=root\x00HOME=/root\x00PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games\x00MAIL=/var/mail/root\x00SHELL=/bin/bash\x00SSH_CLIENT=10.88.0.1 52420 22\x00SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22\x00SSH_TTY=/dev/pts/1\x00TERM=xterm-256color\x00XDG_SESSION_ID=7\x00XDG_RUNTIME_DIR=/run/user/0\x00SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160\x00",
 		expected: Proc{
-			Stat_t{Pid: 0x3b74, Tcomm: "bash", State: "S", Ppid: 15160, Pgrp: 15220, Sid: 15220, Tty_nr: 34817, Tty_pgrp: 29367, Flags: 0x406100, Min_flt: 0x277aa, Cmin_flt: 0x6144cd, Maj_flt: 0xb, Cmaj_flt: 0x31c, Utime: 0x1c, Stime: 0x21, Cutime: 0x6535, Cstime: 0xf27, Priority: 20, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x20056, Vsize: 0x14eb000, Rss: 0x3d9, Rsslim: 0xffffffffffffffff, Start_code: 0x400000, End_code: 0x4eefdc, Start_stack: 0x7fffde811370, Esp: 0x7fffde810e68, Eip: 0x7ffb22a345cc, Pending: "0", Blocked: "65536", Sigign: "3670020", Sigcatch: "1266777851", Wchan: 0xffffffff81069712, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0x7, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x6efdf0, End_data: 0x6f8ca8, Start_brk: 0x1f3f000, Arg_start: 0x7fffde812e65, Arg_end: 0x7fffde812e6b, Env_start: 0x7fffde812e6b, Env_end: 0x7fffde812fee, Exit_code: 0x0},
-			Statm_t{Size: 0x14eb, Resident: 0x3d9, Shared: 0x1c2, Trs: 0xef, Lrs: 0x0, Drs: 0x215, Dt: 0x0},
-			Status_t{Name: "bash", State: "S (sleeping)", Tgid: 0x3b74, Ngid: 0x0, Pid: 0x3b74, PPid: 0x3b38, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x100, Groups: []uint64{0x0}, VmPeak: 0x53e8, VmSize: 0x53ac, VmLck: 0x0, VmPin: 0x0, VmHWM: 0xf7c, VmRSS: 0xf64, VmData: 0x7cc, VmStk: 0x88, VmExe: 0x3bc, VmLib: 0x8f0, VmPTE: 0x3c, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0xefe}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000010000", SigIgn: "0000000000380004", SigCgt: "000000004b817efb", CapInh: "0000000000000000", CapPrm: "0000001fffffffff", CapEff: "0000001fffffffff", CapBnd: "0000001fffffffff", Seccomp: 0x0, Cpus_allowed: "3", Cpus_allowed_list: "0-1", Mems_allowed: "00000000,00000001", Mems_allowed_list: "0", Voluntary_ctxt_switches: 0x20af, Nonvoluntary_ctxt_switches: 0x1c64},
-			[]string{"-bash"},
-			[]string{"LANG=en_US.UTF-8", "USER=root", "LOGNAME=root", "HOME=/root", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games", "MAIL=/var/mail/root", "SHELL=/bin/bash", "SSH_CLIENT=10.88.0.1 52420 22", "SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22", "SSH_TTY=/dev/pts/1", "TERM=xterm-256color", "XDG_SESSION_ID=7", "XDG_RUNTIME_DIR=/run/user/0", "SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160"},
+			Stat:      Stat_t{Pid: 0x3b74, Tcomm: "bash", State: "S", Ppid: 15160, Pgrp: 15220, Sid: 15220, Tty_nr: 34817, Tty_pgrp: 29367, Flags: 0x406100, Min_flt: 0x277aa, Cmin_flt: 0x6144cd, Maj_flt: 0xb, Cmaj_flt: 0x31c, Utime: 0x1c, Stime: 0x21, Cutime: 0x6535, Cstime: 0xf27, Priority: 20, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x20056, Vsize: 0x14eb000, Rss: 0x3d9, Rsslim: 0xffffffffffffffff, Start_code: 0x400000, End_code: 0x4eefdc, Start_stack: 0x7fffde811370, Esp: 0x7fffde810e68, Eip: 0x7ffb22a345cc, Pending: "0", Blocked: "65536", Sigign: "3670020", Sigcatch: "1266777851", Wchan: 0xffffffff81069712, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0x7, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x6efdf0, End_data: 0x6f8ca8, Start_brk: 0x1f3f000, Arg_start: 0x7fffde812e65, Arg_end: 0x7fffde812e6b, Env_start: 0x7fffde812e6b, Env_end: 0x7fffde812fee, Exit_code: 0x0},
+			Statm:     Statm_t{Size: 0x14eb, Resident: 0x3d9, Shared: 0x1c2, Trs: 0xef, Lrs: 0x0, Drs: 0x215, Dt: 0x0},
+			Status:    Status_t{Name: "bash", State: "S (sleeping)", Tgid: 0x3b74, Ngid: 0x0, Pid: 0x3b74, PPid: 0x3b38, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x100, Groups: []uint64{0x0}, VmPeak: 0x53e8, VmSize: 0x53ac, VmLck: 0x0, VmPin: 0x0, VmHWM: 0xf7c, VmRSS: 0xf64, VmData: 0x7cc, VmStk: 0x88, VmExe: 0x3bc, VmLib: 0x8f0, VmPTE: 0x3c, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0xefe}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000010000", SigIgn: "0000000000380004", SigCgt: "000000004b817efb", CapInh: "0000000000000000", CapPrm: "0000001fffffffff", CapEff: "0000001fffffffff", CapBnd: "0000001fffffffff", Seccomp: 0x0, Cpus_allowed: "3", Cpus_allowed_list: "0-1", Mems_allowed: "00000000,00000001", Mems_allowed_list: "0", Voluntary_ctxt_switches: 0x20af, Nonvoluntary_ctxt_switches: 0x1c64},
+			Security:  SecurityContext{LSM: "apparmor", Current: "unconfined", Read: true},
+			LoginUid:  0,
+			SessionId: 7,
+			Cmdline:   []string{"-bash"},
+			Environ:   []string{"LANG=en_US.UTF-8", "USER=root", "LOGNAME=root", "HOME=/root", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games", "MAIL=/var/mail/root", "SHELL=/bin/bash", "SSH_CLIENT=10.88.0.1 52420 22", "SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22", "SSH_TTY=/dev/pts/1", "TERM=xterm-256color", "XDG_SESSION_ID=7", "XDG_RUNTIME_DIR=/run/user/0", "SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160"},
 		},
 	},
 	29821: {
@@ -36,13 +51,19 @@ var testCases = map[uint64]testCase{
 		statmContent:   "2781 293 244 239 0 65 0\n",
 		statusContent:  "Name:\t:-) 0 1 2 3 4 5\nState:\tR (running)\nTgid:\t29821\nNgid:\t0\nPid:\t29821\nPPid:\t15220\nTracerPid:\t0\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\nFDSize:\t256\nGroups:\t0 \nVmPeak:\t   11124 kB\nVmSize:\t   11124 kB\nVmLck:\t       0 kB\nVmPin:\t       0 kB\nVmHWM:\t    1172 kB\nVmRSS:\t    1172 kB\nVmData:\t     124 kB\nVmStk:\t     136 kB\nVmExe:\t     956 kB\nVmLib:\t    2072 kB\nVmPTE:\t      40 kB\nVmSwap:\t       0 kB\nThreads:\t1\nSigQ:\t0/3838\nSigPnd:\t0000000000000000\nShdPnd:\t0000000000000000\nSigBlk:\t0000000000000000\nSigIgn:\t0000000000000004\nSigCgt:\t0000000000010000\nCapInh:\t0000000000000000\nCapPrm:\t0000001fffffffff\nCapEff:\t0000001fffffffff\nCapBnd:\t0000001fffffffff\nSeccomp:\t0\nCpus_allowed:\t3\nCpus_allowed_list:\t0-1\nMems_allowed:\t00000000,00000001\nMems_allowed_list:\t0\nvoluntary_ctxt_switches:\t2\nnonvoluntary_ctxt_switches:\t302\n",
 		cmdlineContent: "/bin/bash\x00/root/gops/procreader/testdata/:-) 0 1 2 3 4 5 6 \x00",
+		attrContent:    "/usr/bin/execer (complain)\n",
+		loginuid:       "0",
+		sessionid:      "7",
 		environContent: "XDG_SESSION_ID=7\x00SHELL=/bin/bash\x00TERM=xterm-256color\x00SSH_CLIENT=10.88.0.1 52420 22\x00SSH_TTY=/dev/pts/1\x00USER=root\x00LS_COLORS=rs=0:di=01;34:ln=01;36:mh=00:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:ca=30;41:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.tlz=01;31:*.txz=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.lz=01;31:*.xz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.war=01;31:*.ear=01;31:*.sar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.svgz=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.webm=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.flv=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.cgm=01;35:*.emf=01;35:*.axv=01;35:*.anx=01;35:*.ogv=01;35:*.ogx=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:*.axa=00;36:*.oga=00;36:*.spx=00;36:*.xspf=00;36:\x00SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160\x00PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games:/usr/local/go/bin\x00MAIL=/var/mail/root\x00_=./execer\x00PWD=/root/gops/procreader/testdata\x00LANG=en_US.UTF-8\x00HOME=/root\x00SHLVL=1\x00LOGNAME=root\x00SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22\x00LESSOPEN=| /usr/bin/lesspipe %s\x00XDG_RUNTIME_DIR=/run/user/0\x00LESSCLOSE=/usr/bin/lesspipe %s %s\x00",
 		expected: Proc{
-			Stat_t{Pid: 0x747d, Tcomm: ":-) 0 1 2 3 4 5", State: "R", Ppid: 15220, Pgrp: 29821, Sid: 15220, Tty_nr: 34817, Tty_pgrp: 29852, Flags: 0x406000, Min_flt: 0x337, Cmin_flt: 0x0, Maj_flt: 0x1, Cmaj_flt: 0x0, Utime: 0xf8c, Stime: 0x3, Cutime: 0x0, Cstime: 0x0, Priority: 20, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x58f50a, Vsize: 0xadd000, Rss: 0x125, Rsslim: 0xffffffffffffffff, Start_code: 0x400000, End_code: 0x4eefdc, Start_stack: 0x7fff53ea60e0, Esp: 0x7fff53ea5ba8, Eip: 0x454e2c, Pending: "0", Blocked: "0", Sigign: "4", Sigcatch: "65536", Wchan: 0x0, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0xd, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x6efdf0, End_data: 0x6f8ca8, Start_brk: 0x146a000, Arg_start: 0x7fff53ea785c, Arg_end: 0x7fff53ea7898, Env_start: 0x7fff53ea7898, Env_end: 0x7fff53ea7fc6, Exit_code: 0x0},
-			Statm_t{Size: 0xadd, Resident: 0x125, Shared: 0xf4, Trs: 0xef, Lrs: 0x0, Drs: 0x41, Dt: 0x0},
-			Status_t{Name: ":-) 0 1 2 3 4 5", State: "R (running)", Tgid: 0x747d, Ngid: 0x0, Pid: 0x747d, PPid: 0x3b74, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x100, Groups: []uint64{0x0}, VmPeak: 0x2b74, VmSize: 0x2b74, VmLck: 0x0, VmPin: 0x0, VmHWM: 0x494, VmRSS: 0x494, VmData: 0x7c, VmStk: 0x88, VmExe: 0x3bc, VmLib: 0x818, VmPTE: 0x28, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0xefe}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000000000", SigIgn: "0000000000000004", SigCgt: "0000000000010000", CapInh: "0000000000000000", CapPrm: "0000001fffffffff", CapEff: "0000001fffffffff", CapBnd: "0000001fffffffff", Seccomp: 0x0, Cpus_allowed: "3", Cpus_allowed_list: "0-1", Mems_allowed: "00000000,00000001", Mems_allowed_list: "0", Voluntary_ctxt_switches: 0x2, Nonvoluntary_ctxt_switches: 0x12e},
-			[]string{"/bin/bash", "/root/gops/procreader/testdata/:-) 0 1 2 3 4 5 6 "},
-			[]string{"XDG_SESSION_ID=7", "SHELL=/bin/bash", "TERM=xterm-256color", "SSH_CLIENT=10.88.0.1 52420 22", "SSH_TTY=/dev/pts/1", "USER=root", "LS_COLORS=rs=0:di=01;34:ln=01;36:mh=00:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:ca=30;41:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.tlz=01;31:*.txz=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.lz=01;31:*.xz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.war=01;31:*.ear=01;31:*.sar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.svgz=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.webm=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.flv=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.cgm=01;35:*.emf=01;35:*.axv=01;35:*.anx=01;35:*.ogv=01;35:*.ogx=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:*.axa=00;36:*.oga=00;36:*.spx=00;36:*.xspf=00;36:", "SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games:/usr/local/go/bin", "MAIL=/var/mail/root", "_=./execer", "PWD=/root/gops/procreader/testdata", "LANG=en_US.UTF-8", "HOME=/root", "SHLVL=1", "LOGNAME=root", "SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22", "LESSOPEN=| /usr/bin/lesspipe %s", "XDG_RUNTIME_DIR=/run/user/0", "LESSCLOSE=/usr/bin/lesspipe %s %s"},
+			Stat:      Stat_t{Pid: 0x747d, Tcomm: ":-) 0 1 2 3 4 5", State: "R", Ppid: 15220, Pgrp: 29821, Sid: 15220, Tty_nr: 34817, Tty_pgrp: 29852, Flags: 0x406000, Min_flt: 0x337, Cmin_flt: 0x0, Maj_flt: 0x1, Cmaj_flt: 0x0, Utime: 0xf8c, Stime: 0x3, Cutime: 0x0, Cstime: 0x0, Priority: 20, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x58f50a, Vsize: 0xadd000, Rss: 0x125, Rsslim: 0xffffffffffffffff, Start_code: 0x400000, End_code: 0x4eefdc, Start_stack: 0x7fff53ea60e0, Esp: 0x7fff53ea5ba8, Eip: 0x454e2c, Pending: "0", Blocked: "0", Sigign: "4", Sigcatch: "65536", Wchan: 0x0, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0xd, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x6efdf0, End_data: 0x6f8ca8, Start_brk: 0x146a000, Arg_start: 0x7fff53ea785c, Arg_end: 0x7fff53ea7898, Env_start: 0x7fff53ea7898, Env_end: 0x7fff53ea7fc6, Exit_code: 0x0},
+			Statm:     Statm_t{Size: 0xadd, Resident: 0x125, Shared: 0xf4, Trs: 0xef, Lrs: 0x0, Drs: 0x41, Dt: 0x0},
+			Status:    Status_t{Name: ":-) 0 1 2 3 4 5", State: "R (running)", Tgid: 0x747d, Ngid: 0x0, Pid: 0x747d, PPid: 0x3b74, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x100, Groups: []uint64{0x0}, VmPeak: 0x2b74, VmSize: 0x2b74, VmLck: 0x0, VmPin: 0x0, VmHWM: 0x494, VmRSS: 0x494, VmData: 0x7c, VmStk: 0x88, VmExe: 0x3bc, VmLib: 0x818, VmPTE: 0x28, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0xefe}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000000000", SigIgn: "0000000000000004", SigCgt: "0000000000010000", CapInh: "0000000000000000", CapPrm: "0000001fffffffff", CapEff: "0000001fffffffff", CapBnd: "0000001fffffffff", Seccomp: 0x0, Cpus_allowed: "3", Cpus_allowed_list: "0-1", Mems_allowed: "00000000,00000001", Mems_allowed_list: "0", Voluntary_ctxt_switches: 0x2, Nonvoluntary_ctxt_switches: 0x12e},
+			Security:  SecurityContext{LSM: "apparmor", Current: "/usr/bin/execer (complain)", Mode: "complain", Read: true},
+			LoginUid:  0,
+			SessionId: 7,
+			Cmdline:   []string{"/bin/bash", "/root/gops/procreader/testdata/:-) 0 1 2 3 4 5 6 "},
+			Environ:   []string{"XDG_SESSION_ID=7", "SHELL=/bin/bash", "TERM=xterm-256color", "SSH_CLIENT=10.88.0.1 52420 22", "SSH_TTY=/dev/pts/1", "USER=root", "LS_COLORS=rs=0:di=01;34:ln=01;36:mh=00:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:ca=30;41:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.tlz=01;31:*.txz=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.lz=01;31:*.xz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.war=01;31:*.ear=01;31:*.sar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.svgz=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.webm=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.flv=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.cgm=01;35:*.emf=01;35:*.axv=01;35:*.anx=01;35:*.ogv=01;35:*.ogx=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:*.axa=00;36:*.oga=00;36:*.spx=00;36:*.xspf=00;36:", "SSH_AUTH_SOCK=/tmp/ssh-W5s8CB8xWd/agent.15160", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games:/usr/local/go/bin", "MAIL=/var/mail/root", "_=./execer", "PWD=/root/gops/procreader/testdata", "LANG=en_US.UTF-8", "HOME=/root", "SHLVL=1", "LOGNAME=root", "SSH_CONNECTION=10.88.0.1 52420 10.88.0.151 22", "LESSOPEN=| /usr/bin/lesspipe %s", "XDG_RUNTIME_DIR=/run/user/0", "LESSCLOSE=/usr/bin/lesspipe %s %s"},
 		},
 	},
 	// This one came from 2.6.18 and has a different number of fields
@@ -51,23 +72,31 @@ var testCases = map[uint64]testCase{
 		statmContent:   "12226 300 171 106 0 138 0\n",
 		statusContent:  "Name:\tsshd\nState:\tS (sleeping)\nSleepAVG:\t98%\nTgid:\t29167\nPid:\t29167\nPPid:\t1\nTracerPid:\t0\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\nFDSize:\t64\nGroups:\t\nVmPeak:\t   48908 kB\nVmSize:\t   48904 kB\nVmLck:\t       0 kB\nVmHWM:\t    1200 kB\nVmRSS:\t    1200 kB\nVmData:\t     468 kB\nVmStk:\t      84 kB\nVmExe:\t     424 kB\nVmLib:\t    4652 kB\nVmPTE:\t     112 kB\nThreads:\t1\nSigQ:\t0/2112\nSigPnd:\t0000000000000000\nShdPnd:\t0000000000000000\nSigBlk:\t0000000000000000\nSigIgn:\t0000000000001000\nSigCgt:\t0000000180014005\nCapInh:\t0000000000000000\nCapPrm:\t00000000fffffeff\nCapEff:\t00000000fffffeff\nCpus_allowed:\tffffffff\nMems_allowed:\t1\n",
 		cmdlineContent: "/usr/sbin/sshd\x00",
+		loginuid:       "4294967295", // 2.6.18 has no sessionid
 		environContent: "SUDO_GID=1000\x00USER=root\x00MAIL=/var/mail/josh\x00HOME=/home/josh\x00SUDO_UID=1000\x00LOGNAME=root\x00USERNAME=root\x00TERM=xterm-color\x00PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/X11R6/bin:/usr/sbin:/sbin\x00SSHD_OOM_ADJUST=-17\x00LS_COLORS=no=00:fi=00:di=01;34:ln=01;36:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.svgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:\x00SUDO_COMMAND=/etc/init.d/ssh restart\x00SHELL=/bin/bash\x00SUDO_USER=josh\x00PWD=/home/josh\x00",
 		expected: Proc{
-			Stat_t{Pid: 0x71ef, Tcomm: "sshd", State: "S", Ppid: 1, Pgrp: 29167, Sid: 29167, Tty_nr: 0, Tty_pgrp: -1, Flags: 0x402140, Min_flt: 0x20d85c3, Cmin_flt: 0x7b94ab17, Maj_flt: 0x0, Cmaj_flt: 0x200, Utime: 0x1ef, Stime: 0xa37, Cutime: 0x2403b, Cstime: 0x1c29e, Priority: 15, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x336397f, Vsize: 0x2fc2000, Rss: 0x12c, Rsslim: 0xffffffffffffffff, Start_code: 0x555555554000, End_code: 0x5555555bd44c, Start_stack: 0x7fff43a0f2e0, Esp: 0xffffffffffffffff, Eip: 0x2b0e692ce463, Pending: "0", Blocked: "0", Sigign: "4096", Sigcatch: "81925", Wchan: 0x0, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0x0, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x0, End_data: 0x0, Start_brk: 0x0, Arg_start: 0x0, Arg_end: 0x0, Env_start: 0x0, Env_end: 0x0, Exit_code: 0x0},
-			Statm_t{Size: 0x2fc2, Resident: 0x12c, Shared: 0xab, Trs: 0x6a, Lrs: 0x0, Drs: 0x8a, Dt: 0x0},
-			Status_t{Name: "sshd", State: "S (sleeping)", Tgid: 0x71ef, Ngid: 0x0, Pid: 0x71ef, PPid: 0x1, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x40, Groups: []uint64(nil), VmPeak: 0xbf0c, VmSize: 0xbf08, VmLck: 0x0, VmPin: 0x0, VmHWM: 0x4b0, VmRSS: 0x4b0, VmData: 0x1d4, VmStk: 0x54, VmExe: 0x1a8, VmLib: 0x122c, VmPTE: 0x70, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0x840}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000000000", SigIgn: "0000000000001000", SigCgt: "0000000180014005", CapInh: "0000000000000000", CapPrm: "00000000fffffeff", CapEff: "00000000fffffeff", CapBnd: "", Seccomp: 0x0, Cpus_allowed: "ffffffff", Cpus_allowed_list: "", Mems_allowed: "1", Mems_allowed_list: "", Voluntary_ctxt_switches: 0x0, Nonvoluntary_ctxt_switches: 0x0},
-			[]string{"/usr/sbin/sshd"},
-			[]string{"SUDO_GID=1000", "USER=root", "MAIL=/var/mail/josh", "HOME=/home/josh", "SUDO_UID=1000", "LOGNAME=root", "USERNAME=root", "TERM=xterm-color", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/X11R6/bin:/usr/sbin:/sbin", "SSHD_OOM_ADJUST=-17", "LS_COLORS=no=00:fi=00:di=01;34:ln=01;36:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.svgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:", "SUDO_COMMAND=/etc/init.d/ssh restart", "SHELL=/bin/bash", "SUDO_USER=josh", "PWD=/home/josh"},
+			Stat:      Stat_t{Pid: 0x71ef, Tcomm: "sshd", State: "S", Ppid: 1, Pgrp: 29167, Sid: 29167, Tty_nr: 0, Tty_pgrp: -1, Flags: 0x402140, Min_flt: 0x20d85c3, Cmin_flt: 0x7b94ab17, Maj_flt: 0x0, Cmaj_flt: 0x200, Utime: 0x1ef, Stime: 0xa37, Cutime: 0x2403b, Cstime: 0x1c29e, Priority: 15, Nice: 0, Num_threads: 0x1, it_real_value: 0x0, Start_time: 0x336397f, Vsize: 0x2fc2000, Rss: 0x12c, Rsslim: 0xffffffffffffffff, Start_code: 0x555555554000, End_code: 0x5555555bd44c, Start_stack: 0x7fff43a0f2e0, Esp: 0xffffffffffffffff, Eip: 0x2b0e692ce463, Pending: "0", Blocked: "0", Sigign: "4096", Sigcatch: "81925", Wchan: 0x0, placeholder1: 0x0, placeholder2: 0x0, Exit_signal: 0x11, Task_cpu: 0x0, Rt_priority: 0x0, Policy: 0x0, Blkio_ticks: 0x0, Gtime: 0x0, Cgtime: 0x0, Start_data: 0x0, End_data: 0x0, Start_brk: 0x0, Arg_start: 0x0, Arg_end: 0x0, Env_start: 0x0, Env_end: 0x0, Exit_code: 0x0},
+			Statm:     Statm_t{Size: 0x2fc2, Resident: 0x12c, Shared: 0xab, Trs: 0x6a, Lrs: 0x0, Drs: 0x8a, Dt: 0x0},
+			Status:    Status_t{Name: "sshd", State: "S (sleeping)", Tgid: 0x71ef, Ngid: 0x0, Pid: 0x71ef, PPid: 0x1, TracerPid: 0x0, Uid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, Gid: Ids{Real: 0x0, Effective: 0x0, Saved: 0x0, FS: 0x0}, FDSize: 0x40, Groups: []uint64(nil), VmPeak: 0xbf0c, VmSize: 0xbf08, VmLck: 0x0, VmPin: 0x0, VmHWM: 0x4b0, VmRSS: 0x4b0, VmData: 0x1d4, VmStk: 0x54, VmExe: 0x1a8, VmLib: 0x122c, VmPTE: 0x70, VmSwap: 0x0, Threads: 0x1, SigQ: SigQVal{Num: 0x0, Max: 0x840}, SigPnd: "0000000000000000", ShdPnd: "0000000000000000", SigBlk: "0000000000000000", SigIgn: "0000000000001000", SigCgt: "0000000180014005", CapInh: "0000000000000000", CapPrm: "00000000fffffeff", CapEff: "00000000fffffeff", CapBnd: "", Seccomp: 0x0, Cpus_allowed: "ffffffff", Cpus_allowed_list: "", Mems_allowed: "1", Mems_allowed_list: "", Voluntary_ctxt_switches: 0x0, Nonvoluntary_ctxt_switches: 0x0},
+			Security:  SecurityContext{Read: true}, // no attr files on 2.6.18
+			LoginUid:  AuditUnset,
+			SessionId: AuditUnset,
+			Cmdline:   []string{"/usr/sbin/sshd"},
+			Environ:   []string{"SUDO_GID=1000", "USER=root", "MAIL=/var/mail/josh", "HOME=/home/josh", "SUDO_UID=1000", "LOGNAME=root", "USERNAME=root", "TERM=xterm-color", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/X11R6/bin:/usr/sbin:/sbin", "SSHD_OOM_ADJUST=-17", "LS_COLORS=no=00:fi=00:di=01;34:ln=01;36:pi=40;33:so=01;35:do=01;35:bd=40;33;01:cd=40;33;01:or=40;31;01:su=37;41:sg=30;43:tw=30;42:ow=34;42:st=37;44:ex=01;32:*.tar=01;31:*.tgz=01;31:*.svgz=01;31:*.arj=01;31:*.taz=01;31:*.lzh=01;31:*.lzma=01;31:*.zip=01;31:*.z=01;31:*.Z=01;31:*.dz=01;31:*.gz=01;31:*.bz2=01;31:*.bz=01;31:*.tbz2=01;31:*.tz=01;31:*.deb=01;31:*.rpm=01;31:*.jar=01;31:*.rar=01;31:*.ace=01;31:*.zoo=01;31:*.cpio=01;31:*.7z=01;31:*.rz=01;31:*.jpg=01;35:*.jpeg=01;35:*.gif=01;35:*.bmp=01;35:*.pbm=01;35:*.pgm=01;35:*.ppm=01;35:*.tga=01;35:*.xbm=01;35:*.xpm=01;35:*.tif=01;35:*.tiff=01;35:*.png=01;35:*.svg=01;35:*.mng=01;35:*.pcx=01;35:*.mov=01;35:*.mpg=01;35:*.mpeg=01;35:*.m2v=01;35:*.mkv=01;35:*.ogm=01;35:*.mp4=01;35:*.m4v=01;35:*.mp4v=01;35:*.vob=01;35:*.qt=01;35:*.nuv=01;35:*.wmv=01;35:*.asf=01;35:*.rm=01;35:*.rmvb=01;35:*.flc=01;35:*.avi=01;35:*.fli=01;35:*.gl=01;35:*.dl=01;35:*.xcf=01;35:*.xwd=01;35:*.yuv=01;35:*.aac=00;36:*.au=00;36:*.flac=00;36:*.mid=00;36:*.midi=00;36:*.mka=00;36:*.mp3=00;36:*.mpc=00;36:*.ogg=00;36:*.ra=00;36:*.wav=00;36:", "SUDO_COMMAND=/etc/init.d/ssh restart", "SHELL=/bin/bash", "SUDO_USER=josh", "PWD=/home/josh"},
 		},
 	},
 }
 
+// status from a 6.18 kernel, which has keys Status_t doesn't (Umask, NSpid,
+// Kthread, RssAnon, CapAmb, Seccomp_filters, Speculation_Store_Bypass, ...)
+const currentStatusContent = "Name:\tbash\nUmask:\t0022\nState:\tS (sleeping)\nTgid:\t4321\nNgid:\t0\nPid:\t4321\nPPid:\t4300\nTracerPid:\t0\nUid:\t1000\t1000\t1000\t1000\nGid:\t1000\t1000\t1000\t1000\nFDSize:\t256\nGroups:\t4 27 1000 \nNStgid:\t4321\nNSpid:\t4321\nNSpgid:\t4321\nNSsid:\t4321\nKthread:\t0\nVmPeak:\t    8664 kB\nVmSize:\t    8600 kB\nVmLck:\t       0 kB\nVmPin:\t       0 kB\nVmHWM:\t    5120 kB\nVmRSS:\t    5120 kB\nRssAnon:\t    1792 kB\nRssFile:\t    3328 kB\nRssShmem:\t       0 kB\nVmData:\t    2000 kB\nVmStk:\t     132 kB\nVmExe:\t     892 kB\nVmLib:\t    1904 kB\nVmPTE:\t      56 kB\nVmSwap:\t       0 kB\nHugetlbPages:\t       0 kB\nCoreDumping:\t0\nTHP_enabled:\t1\nuntag_mask:\t0xffffffffffffffff\nThreads:\t1\nSigQ:\t0/23959\nSigPnd:\t0000000000000000\nShdPnd:\t0000000000000000\nSigBlk:\t0000000000010000\nSigIgn:\t0000000000380004\nSigCgt:\t000000004b817efb\nCapInh:\t0000000000000000\nCapPrm:\t0000000000000000\nCapEff:\t0000000000000000\nCapBnd:\t000001ffffffffff\nCapAmb:\t0000000000000000\nNoNewPrivs:\t0\nSeccomp:\t0\nSeccomp_filters:\t0\nSpeculation_Store_Bypass:\tthread vulnerable\nSpeculationIndirectBranch:\tconditional enabled\nCpus_allowed:\tf\nCpus_allowed_list:\t0-3\nMems_allowed:\t00000000,00000001\nMems_allowed_list:\t0\nvoluntary_ctxt_switches:\t120\nnonvoluntary_ctxt_switches:\t7\n"
+
 func TestReadProc(t *testing.T) {
 	var cfg procConfig
 	var pid uint64
 	var tc testCase
 
-	cfg.basepath = "/proc"
+	cfg.fields = AllFields | Security | AuditIds
 
 	for pid, tc = range testCases {
 		contents := map[string]string{
@@ -79,6 +108,21 @@ func TestReadProc(t *testing.T) {
 		}
 		cfg.contents = contents
 
+		// the files that aren't always there come from fsys, missing
+		// ones and all
+		dir := fmt.Sprintf("%d/", pid)
+		fsys := fstest.MapFS{dir + "attr": {Mode: fs.ModeDir}}
+		for name, content := range map[string]string{
+			"attr/current": tc.attrContent,
+			"loginuid":     tc.loginuid,
+			"sessionid":    tc.sessionid,
+		} {
+			if content != "" {
+				fsys[dir+name] = &fstest.MapFile{Data: []byte(content)}
+			}
+		}
+		cfg.fsys = fsys
+
 		actual, err := readProc(&cfg, pid)
 		if err != nil {
 			t.Errorf("readProc: %s\n%s\n", err.Error(), err.(*ProcErr).Stack)
@@ -109,6 +153,19 @@ func TestReadProc(t *testing.T) {
 		} else {
 			fmt.Printf("ok <%d> environ matches\n", pid)
 		}
+		if !reflect.DeepEqual(actual.Security, testCases[pid].expected.Security) {
+			t.Errorf("<%d> security: actual != expected: %#v\n", pid, actual.Security)
+		} else {
+			fmt.Printf("ok <%d> security matches\n", pid)
+		}
+		if actual.LoginUid != testCases[pid].expected.LoginUid ||
+			actual.SessionId != testCases[pid].expected.SessionId {
+			t.Errorf("<%d> audit ids: expected %d/%d, got %d/%d\n", pid,
+				testCases[pid].expected.LoginUid, testCases[pid].expected.SessionId,
+				actual.LoginUid, actual.SessionId)
+		} else {
+			fmt.Printf("ok <%d> loginuid and sessionid match\n", pid)
+		}
 	}
 }
 
@@ -118,7 +175,7 @@ func TestBadProcDir(t *testing.T) {
 
 	pid = 1
 
-	cfg.basepath = "/nonexistent/path"
+	cfg.fsys = dirFS("/nonexistent/path")
 	_, err := readProc(&cfg, pid)
 	if err == nil {
 		t.Errorf("readProc: %s\n%s\n", err.Error(), err.(*ProcErr).Stack)
@@ -133,7 +190,7 @@ func TestIncompleteStat(t *testing.T) {
 
 	pid = 1
 
-	cfg.basepath = "/proc"
+	cfg.fsys = dirFS("/proc")
 
 	contents := map[string]string{
 		"stat":    "",
@@ -151,3 +208,449 @@ func TestIncompleteStat(t *testing.T) {
 		fmt.Printf("ok fails: %s\n", err.Error())
 	}
 }
+
+func TestReadSecurity(t *testing.T) {
+	var cfg procConfig
+	var proc Proc
+
+	// anything not in contents will fail to read and be treated as missing
+	cfg.fsys = dirFS("/nonexistent/path")
+
+	tests := []struct {
+		contents   map[string]string
+		expected   SecurityContext
+		unconfined bool
+	}{
+		{
+			map[string]string{
+				"attr/current": "system_u:system_r:httpd_t:s0\x00",
+				"attr/exec":    "",
+				"attr/prev":    "system_u:system_r:init_t:s0\x00",
+			},
+			SecurityContext{LSM: "selinux", Current: "system_u:system_r:httpd_t:s0", Prev: "system_u:system_r:init_t:s0", Read: true},
+			false,
+		},
+		{
+			map[string]string{
+				"attr/current": "unconfined_u:unconfined_r:unconfined_t:s0-s0:c0.c1023\x00",
+			},
+			SecurityContext{LSM: "selinux", Current: "unconfined_u:unconfined_r:unconfined_t:s0-s0:c0.c1023", Read: true},
+			true,
+		},
+		{
+			map[string]string{
+				"attr/apparmor/current": "/usr/sbin/cupsd (enforce)\n",
+				"attr/apparmor/prev":    "unconfined\n",
+			},
+			SecurityContext{LSM: "apparmor", Current: "/usr/sbin/cupsd (enforce)", Prev: "unconfined", Mode: "enforce", Read: true},
+			false,
+		},
+		{
+			map[string]string{
+				"attr/current": "unconfined\n",
+			},
+			SecurityContext{LSM: "apparmor", Current: "unconfined", Read: true},
+			true,
+		},
+		{
+			map[string]string{},
+			SecurityContext{Read: true},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		cfg.contents = tt.contents
+
+		err := readSecurity(&cfg, 1, &proc)
+		if err != nil {
+			t.Errorf("readSecurity: %s\n", err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(proc.Security, tt.expected) {
+			t.Errorf("readSecurity: actual != expected: %#v\n", proc.Security)
+		} else if proc.Security.Unconfined() != tt.unconfined {
+			t.Errorf("readSecurity: '%s' expected unconfined=%t\n",
+				proc.Security.Current, tt.unconfined)
+		} else {
+			fmt.Printf("ok security '%s' matches\n", proc.Security.Current)
+		}
+	}
+
+	// without Security in Fields(), there's no telling
+	var unread SecurityContext
+	if unread.Unconfined() {
+		t.Errorf("Unconfined(): expected false when not read\n")
+	} else {
+		fmt.Printf("ok unread security isn't unconfined\n")
+	}
+}
+
+func TestReadAuditIds(t *testing.T) {
+	var cfg procConfig
+	var proc Proc
+
+	cfg.fsys = dirFS("/nonexistent/path")
+
+	cfg.contents = map[string]string{
+		"loginuid":  "1000",
+		"sessionid": "7",
+	}
+	err := readAuditIds(&cfg, 1, &proc)
+	if err != nil {
+		t.Errorf("readAuditIds: %s\n", err.Error())
+	} else if proc.LoginUid != 1000 || proc.SessionId != 7 {
+		t.Errorf("readAuditIds: expected 1000/7, got %d/%d\n", proc.LoginUid, proc.SessionId)
+	} else {
+		fmt.Printf("ok loginuid %d sessionid %d\n", proc.LoginUid, proc.SessionId)
+	}
+
+	// daemons started at boot have never logged in
+	cfg.contents = map[string]string{
+		"loginuid":  "4294967295",
+		"sessionid": "4294967295",
+	}
+	err = readAuditIds(&cfg, 1, &proc)
+	if err != nil {
+		t.Errorf("readAuditIds: %s\n", err.Error())
+	} else if proc.LoginUid != AuditUnset || proc.SessionId != AuditUnset {
+		t.Errorf("readAuditIds: expected unset, got %d/%d\n", proc.LoginUid, proc.SessionId)
+	} else {
+		fmt.Printf("ok loginuid and sessionid unset\n")
+	}
+
+	// kernels without CONFIG_AUDIT don't have the files at all
+	cfg.contents = map[string]string{}
+	cfg.fsys = fstest.MapFS{"1/stat": {Data: []byte("1 (init) S 0\n")}}
+	err = readAuditIds(&cfg, 1, &proc)
+	if err != nil {
+		t.Errorf("readAuditIds: %s\n", err.Error())
+	} else if proc.LoginUid != AuditUnset || proc.SessionId != AuditUnset {
+		t.Errorf("readAuditIds: expected unset, got %d/%d\n", proc.LoginUid, proc.SessionId)
+	} else {
+		fmt.Printf("ok missing loginuid and sessionid unset\n")
+	}
+
+	// but neither does a process that's exited, which mustn't look unset
+	cfg.fsys = fstest.MapFS{}
+	err = readAuditIds(&cfg, 1, &proc)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("readAuditIds: expected exited process to fail, got %v\n", err)
+	} else {
+		fmt.Printf("ok missing loginuid of exited process: %v\n", err)
+	}
+}
+
+func TestReadFields(t *testing.T) {
+	var cfg procConfig
+	var pid uint64
+
+	pid = 15220
+
+	// only stat can be read, anything else fails
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"stat": testCases[pid].statContent,
+	}
+
+	cfg.fields = Stat
+	proc, err := readProc(&cfg, pid)
+	if err != nil {
+		t.Errorf("readProc(Stat): %s\n", err.Error())
+	} else if !reflect.DeepEqual(proc.Stat, testCases[pid].expected.Stat) || proc.Cmdline != nil {
+		t.Errorf("readProc(Stat): actual != expected\n")
+	} else {
+		fmt.Printf("ok <%d> only stat read\n", pid)
+	}
+
+	cfg.fields = Stat | Environ
+	_, err = readProc(&cfg, pid)
+	if err == nil {
+		t.Errorf("readProc(Stat|Environ): expected an error\n")
+	} else {
+		fmt.Printf("ok <%d> environ read: %s\n", pid, err.Error())
+	}
+
+	Fields(Cmdline)(&cfg)
+	if cfg.fields != Cmdline {
+		t.Errorf("Fields(Cmdline): got %d\n", cfg.fields)
+	} else {
+		fmt.Printf("ok Fields(Cmdline)\n")
+	}
+}
+
+func TestReadPartial(t *testing.T) {
+	var cfg procConfig
+	var pid uint64
+
+	pid = 15220
+
+	// the process exists, but environ (like other users' processes) and the
+	// optional files are missing
+	cfg.fsys = fstest.MapFS{"15220": {Mode: os.ModeDir}}
+	cfg.contents = map[string]string{
+		"stat":    testCases[pid].statContent,
+		"statm":   testCases[pid].statmContent,
+		"status":  testCases[pid].statusContent,
+		"cmdline": testCases[pid].cmdlineContent,
+	}
+
+	_, err := readProc(&cfg, pid)
+	if err == nil {
+		t.Errorf("readProc: expected an error without Partial()\n")
+	} else {
+		fmt.Printf("ok <%d> fails without Partial(): %s\n", pid, err.Error())
+	}
+
+	Partial()(&cfg)
+	proc, err := readProc(&cfg, pid)
+	partial, ok := err.(*PartialErr)
+	if !ok {
+		t.Fatalf("readProc: expected a PartialErr, got %v\n", err)
+	}
+	if !reflect.DeepEqual(partial.Files(), []string{"environ"}) {
+		t.Errorf("readProc: unexpected failed files %v\n", partial.Files())
+	} else if !isUnavailable(partial.Errors["environ"]) {
+		t.Errorf("readProc: unexpected environ error %v\n", partial.Errors["environ"])
+	} else {
+		fmt.Printf("ok <%d> partial: %s\n", pid, err.Error())
+	}
+	if !reflect.DeepEqual(proc.Stat, testCases[pid].expected.Stat) ||
+		!reflect.DeepEqual(proc.Status, testCases[pid].expected.Status) ||
+		!reflect.DeepEqual(proc.Cmdline, testCases[pid].expected.Cmdline) {
+		t.Errorf("readProc: partial actual != expected\n")
+	} else {
+		fmt.Printf("ok <%d> partial proc matches\n", pid)
+	}
+
+	// a process that has gone is still an error
+	cfg.fsys = dirFS("/nonexistent/path")
+	_, err = readProc(&cfg, pid)
+	if _, ok := err.(*PartialErr); ok || !errors.Is(err, ErrProcessGone) {
+		t.Errorf("readProc: expected ErrProcessGone, got %v\n", err)
+	} else {
+		fmt.Printf("ok <%d> gone with Partial(): %s\n", pid, err.Error())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var cfg procConfig
+	var parseErr *ParseErr
+	var pid uint64
+
+	pid = 15220
+
+	cfg.fsys = fstest.MapFS{"15220": {Mode: os.ModeDir}}
+	cfg.contents = map[string]string{
+		"stat":   testCases[pid].statContent,
+		"statm":  testCases[pid].statmContent,
+		"status": "Name:\tbash\nUid:\t0\t0\t0\n",
+	}
+
+	_, err := readProc(&cfg, pid)
+	if !errors.Is(err, ErrParse) || !errors.As(err, &parseErr) {
+		t.Errorf("readProc: expected ErrParse, got %v\n", err)
+	} else if parseErr.File != "status" || parseErr.Line != 2 || parseErr.Field != "Uid" {
+		t.Errorf("readProc: unexpected ParseErr %#v\n", parseErr)
+	} else {
+		fmt.Printf("ok <%d> ErrParse: %s\n", pid, err.Error())
+	}
+	if errors.Is(err, ErrProcessGone) || errors.Is(err, ErrPermission) {
+		t.Errorf("readProc: parse error matches other errors\n")
+	}
+
+	cfg.contents["stat"] = strings.Replace(testCases[pid].statContent, " 28 33 ", " 28 x ", 1)
+	_, err = readProc(&cfg, pid)
+	if !errors.As(err, &parseErr) || parseErr.File != "stat" || parseErr.Field != "Stime" {
+		t.Errorf("readProc: expected ParseErr for Stime, got %v\n", err)
+	} else {
+		fmt.Printf("ok <%d> ErrParse: %s\n", pid, err.Error())
+	}
+
+	// what reading another user's environ gives
+	err = wrapError(&fs.PathError{Op: "open", Path: "/proc/1/environ", Err: syscall.EACCES})
+	if !errors.Is(err, ErrPermission) || !isPermission(err) || errors.Is(err, ErrProcessGone) {
+		t.Errorf("EACCES: expected ErrPermission, got %v\n", err)
+	} else {
+		fmt.Printf("ok ErrPermission: %s\n", err.Error())
+	}
+
+	// the kernel's answer when reading files of a process that's exiting
+	cfg.contents = map[string]string{}
+	err = wrapError(&fs.PathError{Op: "read", Path: "/proc/15220/stat", Err: syscall.ESRCH})
+	if !processGone(&cfg, pid, err) {
+		t.Errorf("ESRCH: expected process gone\n")
+	} else {
+		fmt.Printf("ok ESRCH means gone\n")
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	var cfg procConfig
+	var pid uint64
+
+	pid = 15220
+
+	cfg.fsys = fstest.MapFS{"15220": {Mode: os.ModeDir}}
+	cfg.contents = map[string]string{
+		"stat":   testCases[pid].statContent,
+		"statm":  testCases[pid].statmContent,
+		"status": testCases[pid].statusContent,
+	}
+
+	_, err := readProc(&cfg, pid)
+	e, ok := err.(*ProcErr)
+	if !ok || e.Pid != pid || e.File != "cmdline" || e.Field != "" || e.Stack != nil {
+		t.Errorf("readProc: unexpected error %#v\n", err)
+	} else {
+		fmt.Printf("ok <%d> error context: pid %d file %s\n", pid, e.Pid, e.File)
+	}
+
+	cfg.contents["stat"] = strings.Replace(testCases[pid].statContent, " 28 33 ", " 28 x ", 1)
+	_, err = readProc(&cfg, pid)
+	e, ok = err.(*ProcErr)
+	if !ok || e.Pid != pid || e.File != "stat" || e.Field != "Stime" {
+		t.Errorf("readProc: unexpected error %#v\n", err)
+	} else {
+		fmt.Printf("ok <%d> error context: pid %d file %s field %s\n", pid, e.Pid, e.File, e.Field)
+	}
+
+	CaptureStacks(true)
+	defer CaptureStacks(false)
+
+	_, err = readProc(&cfg, pid)
+	e, ok = err.(*ProcErr)
+	if !ok || !strings.Contains(string(e.Stack), "TestErrorContext") {
+		t.Errorf("readProc: expected a stack, got %#v\n", err)
+	} else {
+		fmt.Printf("ok <%d> stack captured (%d bytes)\n", pid, len(e.Stack))
+	}
+}
+
+// reuseFS is testFS() where each read of 15220/stat gets the next of stats
+// (then the last one again), to look like the PID is reused while the
+// process is being read. A "" in stats is the process exiting.
+type reuseFS struct {
+	files fstest.MapFS
+	stats []string
+	reads int
+	gone  bool
+}
+
+func (fsys *reuseFS) Open(name string) (fs.File, error) {
+	if fsys.gone && strings.HasPrefix(name, "15220") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if name != "15220/stat" {
+		return fsys.files.Open(name)
+	}
+
+	stat := fsys.stats[len(fsys.stats)-1]
+	if fsys.reads < len(fsys.stats) {
+		stat = fsys.stats[fsys.reads]
+	}
+	fsys.reads++
+	if stat == "" {
+		fsys.gone = true
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return fstest.MapFS{"stat": {Data: []byte(stat)}}.Open("stat")
+}
+
+func TestPidReuse(t *testing.T) {
+	old := testCases[15220].statContent
+	reused := strings.Replace(old, " 131158 ", " 131200 ", 1)
+
+	// stat with the rest, then after: reused by the end, so read again
+	fsys := &reuseFS{files: testFS(), stats: []string{old, reused}}
+	proc, contents, err := NewReader(fsys).ReadProcData(15220, Fields(Stat|Cmdline))
+	if err != nil || proc.Stat.Start_time != 131200 || contents["stat"] != reused || fsys.reads != 4 {
+		t.Errorf("ReadProcData(reused): unexpected start %d after %d reads (%v)\n",
+			proc.Stat.Start_time, fsys.reads, err)
+	} else {
+		fmt.Printf("ok ReadProcData() reads the new process after the PID is reused\n")
+	}
+
+	// it's the same process, so it's only read once more to check
+	fsys = &reuseFS{files: testFS(), stats: []string{old}}
+	proc, err = NewReader(fsys).ReadProc(15220)
+	if err != nil || proc.Stat.Start_time != 131158 || fsys.reads != 2 {
+		t.Errorf("ReadProc(same): unexpected start %d after %d reads (%v)\n",
+			proc.Stat.Start_time, fsys.reads, err)
+	} else {
+		fmt.Printf("ok ReadProc() reads stat %d times when the PID isn't reused\n", fsys.reads)
+	}
+
+	// nothing to check when stat is all that's read
+	fsys = &reuseFS{files: testFS(), stats: []string{old, reused}}
+	proc, err = NewReader(fsys).ReadProc(15220, Fields(Stat))
+	if err != nil || proc.Stat.Start_time != 131158 || fsys.reads != 1 {
+		t.Errorf("ReadProc(Stat): unexpected start %d after %d reads (%v)\n",
+			proc.Stat.Start_time, fsys.reads, err)
+	} else {
+		fmt.Printf("ok ReadProc(Stat) reads stat once\n")
+	}
+
+	fsys = &reuseFS{files: testFS(), stats: []string{old, reused, old, reused, old, reused}}
+	_, err = NewReader(fsys).ReadProc(15220, Fields(Stat|Cmdline))
+	if !errors.Is(err, ErrProcessGone) || fsys.reads != 6 {
+		t.Errorf("ReadProc(always reused): expected ErrProcessGone after 6 reads, got %v after %d\n",
+			err, fsys.reads)
+	} else {
+		fmt.Printf("ok ReadProc() gives up: %v\n", err)
+	}
+
+	fsys = &reuseFS{files: testFS(), stats: []string{old, ""}}
+	_, err = NewReader(fsys).ReadProc(15220, Fields(Stat|Cmdline))
+	if !errors.Is(err, ErrProcessGone) {
+		t.Errorf("ReadProc(exited): expected ErrProcessGone, got %v\n", err)
+	} else {
+		fmt.Printf("ok ReadProc() exited while reading: %v\n", err)
+	}
+
+	// without stat, just the start time is read before and after
+	fsys = &reuseFS{files: testFS(), stats: []string{old, reused}}
+	proc, err = NewReader(fsys).ReadProc(15220, Fields(Cmdline))
+	if err != nil || fsys.reads != 4 || proc.Stat.Pid != 0 {
+		t.Errorf("ReadProc(Cmdline): unexpected %d reads (%v)\n", fsys.reads, err)
+	} else {
+		fmt.Printf("ok ReadProc(Cmdline) checks the start time too\n")
+	}
+}
+
+func TestReadStatusCurrent(t *testing.T) {
+	var cfg procConfig
+	var proc Proc
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{"status": currentStatusContent}
+
+	err := readStatus(&cfg, 4321, &proc)
+	if err != nil {
+		t.Fatalf("readStatus(): %v\n", err)
+	}
+	status := proc.Status
+	if status.Name != "bash" || status.Pid != 4321 || status.Uid.Effective != 1000 ||
+		!reflect.DeepEqual(status.Groups, []uint64{4, 27, 1000}) || status.VmRSS != 5120 ||
+		status.CapBnd != "000001ffffffffff" || status.Seccomp != 0 ||
+		status.Cpus_allowed_list != "0-3" || status.Nonvoluntary_ctxt_switches != 7 {
+		t.Errorf("readStatus(): unexpected %#v\n", status)
+	} else {
+		fmt.Printf("ok readStatus() skips keys added by newer kernels\n")
+	}
+
+	for _, bad := range []string{
+		"Name:\tbash\nState S (sleeping)\n", // no ':'
+		"Name:\tbash\n:\t1\n",               // no key
+		"Pid:\tx\n",                         // bad value
+	} {
+		cfg.contents = map[string]string{"status": bad}
+		err := readStatus(&cfg, 4321, &proc)
+		if !errors.Is(err, ErrParse) {
+			t.Errorf("readStatus(%q): expected ErrParse, got %v\n", bad, err)
+			continue
+		}
+		fmt.Printf("ok readStatus(%q) fails: %v\n", bad, err)
+	}
+}
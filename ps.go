@@ -0,0 +1,660 @@
+package procreader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+ * Column names, headers and formatting follow procps' ps/output.c, see:
+ * https://gitorious.org/procps/procps/source/3a66fba1e934cbd830df572d8d03c05b4f4a5f1e:ps/output.c
+ */
+
+// PsColumn is one column of 'ps -o' style output.
+type PsColumn struct {
+	Name   string // canonical name, eg. "pid" or "%cpu"
+	Header string // title printed in the header (eg. "PID"), can be overridden with 'name=HEADER'
+	Right  bool   // right-align values (numeric columns)
+
+	format func(f *PsFormatter, proc *Proc) (string, error)
+}
+
+// PsFormatter turns Procs into 'ps -o' style tables. The system wide values
+// are read by NewPsFormatter() but can be changed before formatting (eg. to
+// use a Resolver for a container's root).
+type PsFormatter struct {
+	Columns  []PsColumn
+	Hertz    uint64    // clock ticks per second (USER_HZ)
+	PageSize uint64    // bytes per page
+	Uptime   float64   // seconds since boot, from /proc/uptime
+	BootTime time.Time // when the system booted, from /proc/stat
+	MemTotal uint64    // total usable memory (kB), from /proc/meminfo
+	Now      time.Time // time Uptime was read
+	Resolver *Resolver // used for user and group names, if nil IDs are shown
+
+	cfg procConfig
+}
+
+type psColumnDef struct {
+	header string
+	right  bool
+	format func(f *PsFormatter, proc *Proc) (string, error)
+}
+
+var psColumns = map[string]psColumnDef{
+	"%cpu":       {"%CPU", true, psPcpu},
+	"%mem":       {"%MEM", true, psPmem},
+	"args":       {"COMMAND", false, psArgs},
+	"bsdtime":    {"TIME", true, psBsdtime},
+	"c":          {"C", true, psC},
+	"cmd":        {"CMD", false, psArgs},
+	"cls":        {"CLS", false, psCls},
+	"comm":       {"COMMAND", false, psComm},
+	"etime":      {"ELAPSED", true, psEtime},
+	"etimes":     {"ELAPSED", true, psEtimes},
+	"f":          {"F", true, psFlags},
+	"gid":        {"GID", true, psGid},
+	"group":      {"GROUP", false, psGroup},
+	"maj_flt":    {"MAJFL", true, psMajFlt},
+	"min_flt":    {"MINFL", true, psMinFlt},
+	"ni":         {"NI", true, psNice},
+	"nlwp":       {"NLWP", true, psNlwp},
+	"pgid":       {"PGID", true, psPgid},
+	"pid":        {"PID", true, psPid},
+	"ppid":       {"PPID", true, psPpid},
+	"pri":        {"PRI", true, psPri},
+	"psr":        {"PSR", true, psPsr},
+	"rgid":       {"RGID", true, psRgid},
+	"rgroup":     {"RGROUP", false, psRgroup},
+	"rss":        {"RSS", true, psRss},
+	"rtprio":     {"RTPRIO", true, psRtprio},
+	"ruid":       {"RUID", true, psRuid},
+	"ruser":      {"RUSER", false, psRuser},
+	"s":          {"S", false, psState},
+	"sid":        {"SID", true, psSid},
+	"start":      {"STARTED", true, psStart},
+	"start_time": {"START", false, psStime},
+	"stat":       {"STAT", false, psStat},
+	"stime":      {"STIME", false, psStime},
+	"sz":         {"SZ", true, psSz},
+	"time":       {"TIME", true, psTime},
+	"tname":      {"TTY", false, psTty},
+	"tpgid":      {"TPGID", true, psTpgid},
+	"tty":        {"TT", false, psTty},
+	"ucmd":       {"CMD", false, psComm},
+	"uid":        {"UID", true, psUid},
+	"user":       {"USER", false, psUser},
+	"vsz":        {"VSZ", true, psVsz},
+	"wchan":      {"WCHAN", false, psWchan},
+}
+
+// other names ps accepts for the columns above
+var psAliases = map[string]string{
+	"command": "args",
+	"cputime": "time",
+	"egid":    "gid",
+	"egroup":  "group",
+	"euid":    "uid",
+	"euser":   "user",
+	"nice":    "ni",
+	"pcpu":    "%cpu",
+	"pgrp":    "pgid",
+	"pmem":    "%mem",
+	"policy":  "cls",
+	"rssize":  "rss",
+	"rsz":     "rss",
+	"sess":    "sid",
+	"session": "sid",
+	"state":   "s",
+	"thcount": "nlwp",
+	"tt":      "tty",
+	"ucomm":   "comm",
+	"uname":   "user",
+	"vsize":   "vsz",
+}
+
+// scheduling policies from include/uapi/linux/sched.h as shown by 'ps -o cls'.
+// 4 is SCHED_ISO, which only ever existed in out of tree (-ck) kernels, but
+// procps still shows it.
+var psPolicies = map[uint64]string{
+	0: "TS",
+	1: "FF",
+	2: "RR",
+	3: "B",
+	4: "ISO",
+	5: "IDL",
+	6: "DLN",
+}
+
+// This function parses 'ps -o' style lists of columns such as
+// "pid,ppid,user,%cpu,args" (commas or spaces separate names), each spec being
+// one -o argument. As with ps, a column can be given a different header with
+// 'name=HEADER', in which case the rest of that spec is the header, so use
+// separate specs for more than one (eg. "pid=", "comm=" for no headers).
+func ParsePsColumns(specs ...string) ([]PsColumn, error) {
+	var columns []PsColumn
+
+	for _, spec := range specs {
+		for len(spec) > 0 {
+			var name string
+			var header *string
+
+			end := strings.IndexAny(spec, ", \t=")
+			if end == -1 {
+				name, spec = spec, ""
+			} else if spec[end] == '=' {
+				rest := spec[end+1:]
+				name, header, spec = spec[:end], &rest, ""
+			} else {
+				name, spec = spec[:end], spec[end+1:]
+			}
+			if name == "" {
+				if header != nil {
+					return nil, newError("ParsePsColumns(): missing column name before '='")
+				}
+				continue
+			}
+
+			canonical := strings.ToLower(name)
+			if alias, ok := psAliases[canonical]; ok {
+				canonical = alias
+			}
+			def, ok := psColumns[canonical]
+			if !ok {
+				return nil, newError("ParsePsColumns(): unknown column '%s'", name)
+			}
+
+			column := PsColumn{Name: canonical, Header: def.header, Right: def.right, format: def.format}
+			if header != nil {
+				column.Header = *header
+			}
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, newError("ParsePsColumns(): no columns in %q", specs)
+	}
+
+	return columns, nil
+}
+
+func newPsFormatter(cfg *procConfig, specs ...string) (*PsFormatter, error) {
+	var f PsFormatter
+	var err error
+
+	f.Columns, err = ParsePsColumns(specs...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	f.cfg = *cfg
+
+	f.Hertz, err = readClockTicks(&f.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	f.BootTime, err = readBootTime(&f.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	f.PageSize = uint64(os.Getpagesize())
+	f.Now = time.Now()
+
+	f.Uptime, err = readUptime(&f.cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	lines, err := readSystemLines(&f.cfg, "meminfo")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "MemTotal:") {
+			_, err = fmt.Sscanf(line, "MemTotal: %d kB", &f.MemTotal)
+			if err != nil {
+				return nil, newError("newPsFormatter(): bad meminfo line '%s': %v", line, err)
+			}
+			break
+		}
+	}
+	if f.MemTotal == 0 {
+		return nil, newError("newPsFormatter(): 'MemTotal:' not found in meminfo")
+	}
+
+	return &f, nil
+}
+
+// This function returns a PsFormatter for the columns in specs (see
+// ParsePsColumns()) using the current /proc/uptime, /proc/stat and
+// /proc/meminfo, and resolving user and group names with /etc/passwd and
+// /etc/group.
+func NewPsFormatter(specs ...string) (*PsFormatter, error) {
+	return defaultReader.NewPsFormatter(specs...)
+}
+
+// NewPsFormatter returns a PsFormatter for the processes in r, resolving user
+// and group names with /etc/passwd and /etc/group in r's root filesystem.
+func (r *Reader) NewPsFormatter(specs ...string) (*PsFormatter, error) {
+	cfg := r.config()
+
+	f, err := newPsFormatter(&cfg, specs...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	f.Resolver = newFSResolver(r.sysfs)
+	f.Resolver.root = r.sysroot
+
+	return f, nil
+}
+
+// Titles returns the column headers.
+func (f *PsFormatter) Titles() []string {
+	var titles []string
+
+	for _, column := range f.Columns {
+		titles = append(titles, column.Header)
+	}
+
+	return titles
+}
+
+// Row returns the value of each column for proc.
+func (f *PsFormatter) Row(proc *Proc) ([]string, error) {
+	var row []string
+
+	for _, column := range f.Columns {
+		value, err := column.format(f, proc)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		row = append(row, value)
+	}
+
+	return row, nil
+}
+
+// Rows returns Row() for each of procs, in the same order.
+func (f *PsFormatter) Rows(procs []Proc) ([][]string, error) {
+	var rows [][]string
+
+	for i := range procs {
+		row, err := f.Row(&procs[i])
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Write writes procs to w as aligned text like ps(1) does. The header is
+// omitted if all of the headers are empty (eg. 'pid=,args=').
+func (f *PsFormatter) Write(w io.Writer, procs []Proc) error {
+	rows, err := f.Rows(procs)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	titles := f.Titles()
+	if strings.Join(titles, "") != "" {
+		rows = append([][]string{titles}, rows...)
+	}
+
+	widths := make([]int, len(f.Columns))
+	for _, row := range rows {
+		for i, value := range row {
+			if n := utf8.RuneCountInString(value); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var line []string
+
+		for i, value := range row {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+			switch {
+			case f.Columns[i].Right:
+				value = pad + value
+			case i < len(row)-1:
+				// don't leave trailing spaces after the last column
+				value = value + pad
+			}
+			line = append(line, value)
+		}
+
+		_, err = fmt.Fprintln(w, strings.Join(line, " "))
+		if err != nil {
+			return wrapError(err)
+		}
+	}
+
+	return nil
+}
+
+// seconds the process has been running
+func (f *PsFormatter) elapsed(proc *Proc) uint64 {
+	started := proc.Stat.Start_time / f.Hertz
+	if uint64(f.Uptime) < started {
+		return 0
+	}
+	return uint64(f.Uptime) - started
+}
+
+// StartTime returns the time the process started, in the location of Now.
+func (f *PsFormatter) StartTime(proc *Proc) time.Time {
+	return startTime(f.BootTime, f.Hertz, proc).In(f.Now.Location())
+}
+
+// TtyName returns the process' controlling terminal like TtyName(), but using
+// the proc filesystem and /dev the PsFormatter was created for.
+func (f *PsFormatter) TtyName(proc *Proc) (string, error) {
+	return readTtyName(&f.cfg, proc)
+}
+
+// CPU usage over the life of the process in tenths of a percent
+func (f *PsFormatter) pcpu(proc *Proc) uint64 {
+	seconds := f.elapsed(proc)
+	if seconds == 0 {
+		return 0
+	}
+	return (proc.Stat.Utime + proc.Stat.Stime) * 1000 / f.Hertz / seconds
+}
+
+// Pcpu returns the percentage of CPU time the process has used over its
+// lifetime, as in 'ps -o %cpu'.
+func (f *PsFormatter) Pcpu(proc *Proc) float64 {
+	return float64(f.pcpu(proc)) / 10
+}
+
+// memory usage in tenths of a percent
+func (f *PsFormatter) pmem(proc *Proc) uint64 {
+	var pmem uint64
+
+	if f.MemTotal > 0 {
+		pmem = proc.Status.VmRSS * 1000 / f.MemTotal
+	}
+	if pmem > 999 {
+		pmem = 999
+	}
+	return pmem
+}
+
+// Pmem returns the process' resident set size as a percentage of MemTotal,
+// as in 'ps -o %mem'.
+func (f *PsFormatter) Pmem(proc *Proc) float64 {
+	return float64(f.pmem(proc)) / 10
+}
+
+func (f *PsFormatter) userName(uid uint64) (string, error) {
+	if f.Resolver == nil {
+		return fmt.Sprintf("%d", uid), nil
+	}
+	return f.Resolver.UserName(uid)
+}
+
+func (f *PsFormatter) groupName(gid uint64) (string, error) {
+	if f.Resolver == nil {
+		return fmt.Sprintf("%d", gid), nil
+	}
+	return f.Resolver.GroupName(gid)
+}
+
+func psPcpu(f *PsFormatter, proc *Proc) (string, error) {
+	pcpu := f.pcpu(proc)
+	if pcpu > 999 {
+		return fmt.Sprintf("%d", pcpu/10), nil
+	}
+	return fmt.Sprintf("%d.%d", pcpu/10, pcpu%10), nil
+}
+
+func psPmem(f *PsFormatter, proc *Proc) (string, error) {
+	pmem := f.pmem(proc)
+	return fmt.Sprintf("%d.%d", pmem/10, pmem%10), nil
+}
+
+func psBsdtime(f *PsFormatter, proc *Proc) (string, error) {
+	t := (proc.Stat.Utime + proc.Stat.Stime) / f.Hertz
+	return fmt.Sprintf("%d:%02d", t/60, t%60), nil
+}
+
+func psC(f *PsFormatter, proc *Proc) (string, error) {
+	c := f.pcpu(proc) / 10
+	if c > 99 {
+		c = 99
+	}
+	return fmt.Sprintf("%d", c), nil
+}
+
+func psArgs(f *PsFormatter, proc *Proc) (string, error) {
+	if len(proc.Cmdline) == 0 {
+		// kernel threads and zombies
+		return fmt.Sprintf("[%s]", proc.Stat.Tcomm), nil
+	}
+	return strings.Join(proc.Cmdline, " "), nil
+}
+
+func psComm(f *PsFormatter, proc *Proc) (string, error) {
+	return proc.Stat.Tcomm, nil
+}
+
+func psCls(f *PsFormatter, proc *Proc) (string, error) {
+	if cls, ok := psPolicies[proc.Stat.Policy]; ok {
+		return cls, nil
+	}
+	return "?", nil
+}
+
+func psEtime(f *PsFormatter, proc *Proc) (string, error) {
+	t := f.elapsed(proc)
+	dd, hh, mm, ss := t/86400, t/3600%24, t/60%60, t%60
+
+	switch {
+	case dd > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", dd, hh, mm, ss), nil
+	case hh > 0:
+		return fmt.Sprintf("%02d:%02d:%02d", hh, mm, ss), nil
+	}
+	return fmt.Sprintf("%02d:%02d", mm, ss), nil
+}
+
+func psEtimes(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", f.elapsed(proc)), nil
+}
+
+func psFlags(f *PsFormatter, proc *Proc) (string, error) {
+	// 1 is PF_FORKNOEXEC (0x40) and 4 is PF_SUPERPRIV (0x100)
+	return fmt.Sprintf("%x", (proc.Stat.Flags>>6)&0x7), nil
+}
+
+func psGid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Status.Gid.Effective), nil
+}
+
+func psGroup(f *PsFormatter, proc *Proc) (string, error) {
+	return f.groupName(proc.Status.Gid.Effective)
+}
+
+func psMajFlt(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Maj_flt), nil
+}
+
+func psMinFlt(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Min_flt), nil
+}
+
+// realtime processes have no nice value
+func isRealtime(proc *Proc) bool {
+	return proc.Stat.Policy == 1 || proc.Stat.Policy == 2
+}
+
+func psNice(f *PsFormatter, proc *Proc) (string, error) {
+	if isRealtime(proc) {
+		return "-", nil
+	}
+	return fmt.Sprintf("%d", proc.Stat.Nice), nil
+}
+
+func psNlwp(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Num_threads), nil
+}
+
+func psPgid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Pgrp), nil
+}
+
+func psPid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Pid), nil
+}
+
+func psPpid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Ppid), nil
+}
+
+func psPri(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", 39-proc.Stat.Priority), nil
+}
+
+func psPsr(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Task_cpu), nil
+}
+
+func psRgid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Status.Gid.Real), nil
+}
+
+func psRgroup(f *PsFormatter, proc *Proc) (string, error) {
+	return f.groupName(proc.Status.Gid.Real)
+}
+
+func psRss(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Rss*f.PageSize/1024), nil
+}
+
+func psRtprio(f *PsFormatter, proc *Proc) (string, error) {
+	if !isRealtime(proc) {
+		return "-", nil
+	}
+	return fmt.Sprintf("%d", proc.Stat.Rt_priority), nil
+}
+
+func psRuid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Status.Uid.Real), nil
+}
+
+func psRuser(f *PsFormatter, proc *Proc) (string, error) {
+	return f.userName(proc.Status.Uid.Real)
+}
+
+func psState(f *PsFormatter, proc *Proc) (string, error) {
+	return proc.Stat.State, nil
+}
+
+func psSid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Sid), nil
+}
+
+func psStart(f *PsFormatter, proc *Proc) (string, error) {
+	start := f.StartTime(proc)
+	if f.Now.Sub(start) > 24*time.Hour {
+		return start.Format("Jan 02"), nil
+	}
+	return start.Format("15:04:05"), nil
+}
+
+// https://gitorious.org/procps/procps/source/3a66fba1e934cbd830df572d8d03c05b4f4a5f1e:ps/output.c#L775-794
+func psStat(f *PsFormatter, proc *Proc) (string, error) {
+	stat := proc.Stat.State
+
+	switch {
+	case proc.Stat.Nice < 0:
+		stat += "<"
+	case proc.Stat.Nice > 0:
+		stat += "N"
+	}
+	if proc.Status.VmLck > 0 {
+		stat += "L"
+	}
+	if int64(proc.Stat.Pid) == proc.Stat.Sid {
+		stat += "s"
+	}
+	if proc.Stat.Num_threads > 1 {
+		stat += "l"
+	}
+	if proc.Stat.Tty_pgrp != -1 && proc.Stat.Pgrp == proc.Stat.Tty_pgrp {
+		stat += "+"
+	}
+
+	return stat, nil
+}
+
+func psStime(f *PsFormatter, proc *Proc) (string, error) {
+	start := f.StartTime(proc)
+
+	switch {
+	case start.YearDay() == f.Now.YearDay() && start.Year() == f.Now.Year():
+		return start.Format("15:04"), nil
+	case start.Year() == f.Now.Year():
+		return start.Format("Jan02"), nil
+	}
+	return start.Format("2006"), nil
+}
+
+func psSz(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Vsize/f.PageSize), nil
+}
+
+func psTime(f *PsFormatter, proc *Proc) (string, error) {
+	t := (proc.Stat.Utime + proc.Stat.Stime) / f.Hertz
+	dd, hh, mm, ss := t/86400, t/3600%24, t/60%60, t%60
+
+	if dd > 0 {
+		return fmt.Sprintf("%d-%02d:%02d:%02d", dd, hh, mm, ss), nil
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", hh, mm, ss), nil
+}
+
+func psTpgid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Tty_pgrp), nil
+}
+
+func psTty(f *PsFormatter, proc *Proc) (string, error) {
+	return f.TtyName(proc)
+}
+
+func psUid(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Status.Uid.Effective), nil
+}
+
+func psUser(f *PsFormatter, proc *Proc) (string, error) {
+	return f.userName(proc.Status.Uid.Effective)
+}
+
+func psVsz(f *PsFormatter, proc *Proc) (string, error) {
+	return fmt.Sprintf("%d", proc.Stat.Vsize/1024), nil
+}
+
+// the kernel only reports the symbol name in /proc/<pid>/wchan
+func psWchan(f *PsFormatter, proc *Proc) (string, error) {
+	filename := fmt.Sprintf("%d/wchan", proc.Stat.Pid)
+
+	wchan, err := readContents(&f.cfg, filename, filename)
+	if err != nil {
+		// exited, or not allowed to look
+		if isUnavailable(err) || isPermission(err) {
+			return "?", nil
+		}
+		return "", wrapError(err)
+	}
+	if wchan == "" || wchan == "0" {
+		return "-", nil
+	}
+
+	return wchan, nil
+}
@@ -0,0 +1,194 @@
+package procreader
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func psTestFormatter(t *testing.T, specs ...string) *PsFormatter {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"/uptime":  "1000.50 3900.12\n",
+		"/meminfo": "MemTotal:        2000000 kB\nMemFree:          500000 kB\n",
+		"/stat":    "cpu  100 0 100 1000 0 0 0 0 0 0\nbtime 1425987800\n",
+		"1/wchan":  "do_epoll_wait",
+		"42/wchan": "0",
+	}
+
+	f, err := newPsFormatter(&cfg, specs...)
+	if err != nil {
+		t.Fatalf("newPsFormatter(%q): %v\n", specs, err)
+	}
+	f.PageSize = 4096
+	f.Now = time.Date(2015, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	return f
+}
+
+func psTestProcs() []Proc {
+	var init, shell Proc
+
+	// started at boot, 15 seconds of CPU
+	init.Stat = Stat_t{Pid: 1, Tcomm: "systemd", State: "S", Ppid: 0, Pgrp: 1,
+		Sid: 1, Tty_pgrp: -1, Utime: 1000, Stime: 500, Priority: 20,
+		Num_threads: 1, Start_time: 5, Vsize: 170000 * 1024, Rss: 3000,
+		Flags: 0x400100}
+	init.Status.VmRSS = 12000
+	init.Cmdline = []string{"/sbin/init", "splash"}
+
+	// started 100 seconds ago on pts/3 (136:3), in the foreground, niced
+	shell.Stat = Stat_t{Pid: 42, Tcomm: "bash", State: "R", Ppid: 1, Pgrp: 42,
+		Sid: 40, Tty_nr: 136<<8 | 3, Tty_pgrp: 42, Utime: 50, Stime: 50,
+		Priority: 30, Nice: 10, Num_threads: 3, Start_time: 90050, Task_cpu: 2,
+		Vsize: 8000 * 1024, Rss: 1000}
+	shell.Status.VmRSS = 4000
+	shell.Status.VmLck = 8
+	shell.Status.Uid = Ids{1000, 1000, 1000, 1000}
+	shell.Status.Gid = Ids{100, 100, 100, 100}
+
+	return []Proc{init, shell}
+}
+
+func TestParsePsColumns(t *testing.T) {
+	var tests = []struct {
+		specs   []string
+		names   []string
+		headers []string
+	}{
+		{[]string{"pid,ppid,user,%cpu,args"}, []string{"pid", "ppid", "user", "%cpu", "args"},
+			[]string{"PID", "PPID", "USER", "%CPU", "COMMAND"}},
+		{[]string{"pid tty  PCPU,cmd"}, []string{"pid", "tty", "%cpu", "cmd"},
+			[]string{"PID", "TT", "%CPU", "CMD"}},
+		{[]string{"pid,comm=Name, with spaces"}, []string{"pid", "comm"},
+			[]string{"PID", "Name, with spaces"}},
+		{[]string{"pid=,args="}, []string{"pid"}, []string{",args="}},
+		{[]string{"pid=", "args="}, []string{"pid", "args"}, []string{"", ""}},
+	}
+
+	for _, test := range tests {
+		var names, headers []string
+
+		columns, err := ParsePsColumns(test.specs...)
+		if err != nil {
+			t.Errorf("ParsePsColumns(%q): %v\n", test.specs, err)
+			continue
+		}
+		for _, column := range columns {
+			names = append(names, column.Name)
+			headers = append(headers, column.Header)
+		}
+		if !reflect.DeepEqual(names, test.names) || !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf("ParsePsColumns(%q): expected %q %q, got %q %q\n",
+				test.specs, test.names, test.headers, names, headers)
+			continue
+		}
+		fmt.Printf("ok ParsePsColumns(%q)\n", test.specs)
+	}
+
+	for _, spec := range []string{"", "pid,bogus", "=PID"} {
+		_, err := ParsePsColumns(spec)
+		if err == nil {
+			t.Errorf("ParsePsColumns(%s): expected error\n", spec)
+			continue
+		}
+		fmt.Printf("ok ParsePsColumns(%s) failed: %v\n", spec, err)
+	}
+}
+
+func TestPsFormatterRows(t *testing.T) {
+	spec := "pid,ppid,uid,user,%cpu,%mem,c,vsz,rss,sz,tty,stat,s,time,etime,etimes," +
+		"comm,args,wchan,nlwp,psr,ni,pri,cls,rtprio,f,start,stime"
+
+	f := psTestFormatter(t, spec)
+	rows, err := f.Rows(psTestProcs())
+	if err != nil {
+		t.Fatalf("Rows(): %v\n", err)
+	}
+
+	expect := [][]string{
+		{"1", "0", "0", "0", "1.5", "0.6", "1", "170000", "12000", "42500", "?", "Ss", "S",
+			"00:00:15", "16:40", "1000", "systemd", "/sbin/init splash", "do_epoll_wait",
+			"1", "0", "0", "19", "TS", "-", "4", "11:43:20", "11:43"},
+		{"42", "1", "1000", "1000", "1.0", "0.2", "1", "8000", "4000", "2000", "pts/3", "RNLl+", "R",
+			"00:00:01", "01:40", "100", "bash", "[bash]", "-",
+			"3", "2", "10", "9", "TS", "-", "0", "11:58:20", "11:58"},
+	}
+	for i := range expect {
+		if !reflect.DeepEqual(rows[i], expect[i]) {
+			t.Errorf("Rows()[%d]:\nexpected %q\ngot      %q\n", i, expect[i], rows[i])
+			continue
+		}
+		fmt.Printf("ok Rows()[%d]\n", i)
+	}
+}
+
+func TestPsCls(t *testing.T) {
+	expect := []string{"TS", "FF", "RR", "B", "ISO", "IDL", "DLN", "?"}
+
+	for policy := range expect {
+		var proc Proc
+
+		proc.Stat.Policy = uint64(policy)
+		cls, _ := psCls(nil, &proc)
+		if cls != expect[policy] {
+			t.Errorf("psCls(%d): expected '%s', got '%s'\n", policy, expect[policy], cls)
+			continue
+		}
+		fmt.Printf("ok policy %d == %s\n", policy, cls)
+	}
+}
+
+func TestPsFormatterWrite(t *testing.T) {
+	var tests = []struct {
+		specs  []string
+		expect string
+	}{
+		{[]string{"pid,user,tty,args"},
+			"PID USER TT    COMMAND\n" +
+				"  1 0    ?     /sbin/init splash\n" +
+				" 42 1000 pts/3 [bash]\n"},
+		{[]string{"pid=", "comm="},
+			" 1 systemd\n" +
+				"42 bash\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		f := psTestFormatter(t, test.specs...)
+		err := f.Write(&buf, psTestProcs())
+		if err != nil {
+			t.Errorf("Write(%q): %v\n", test.specs, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("Write(%q): expected:\n%s\ngot:\n%s\n", test.specs, test.expect, buf.String())
+			continue
+		}
+		fmt.Printf("ok Write(%q)\n", test.specs)
+	}
+}
+
+func TestPsFormatterResolver(t *testing.T) {
+	f := psTestFormatter(t, "user,group,ruser,rgroup")
+	f.Resolver = &Resolver{
+		users:  map[uint64]string{0: "root", 1000: "josh"},
+		groups: map[uint64]string{0: "root"},
+	}
+
+	rows, err := f.Rows(psTestProcs())
+	if err != nil {
+		t.Fatalf("Rows(): %v\n", err)
+	}
+	expect := []string{"josh", "100", "josh", "100"}
+	if !reflect.DeepEqual(rows[1], expect) {
+		t.Errorf("Rows(): expected %q, got %q\n", expect, rows[1])
+		return
+	}
+	fmt.Printf("ok Rows() with Resolver\n")
+}
@@ -0,0 +1,125 @@
+package procreader
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ProcResult is a process read by ReadAll(), with Err as ReadProc() would
+// return it.
+type ProcResult struct {
+	Pid  uint64
+	Proc Proc
+	Err  error
+}
+
+// This function returns a ReadOption which has ReadAll() read n processes at
+// a time. The default is runtime.GOMAXPROCS(0).
+func Workers(n int) ReadOption {
+	return func(cfg *procConfig) {
+		cfg.workers = n
+	}
+}
+
+// This function reads all the processes currently in /proc, see
+// (*Reader).ReadAll().
+func ReadAll(ctx context.Context, fn func(ProcResult) error, opts ...ReadOption) error {
+	return defaultReader.ReadAll(ctx, fn, opts...)
+}
+
+// ReadAll reads every process in r (as ReadProc() with opts would), several at
+// a time, and passes each to fn as it's read. fn is only called by the
+// goroutine that called ReadAll(), one process at a time, but in no particular
+// order. Processes that exit before they're read are left out, as if they'd
+// gone before ListPids(). If fn returns an error, or ctx is done, ReadAll()
+// stops reading, doesn't call fn again, and returns that error (or ctx.Err())
+// once its goroutines have finished.
+func (r *Reader) ReadAll(ctx context.Context, fn func(ProcResult) error, opts ...ReadOption) error {
+	var wg sync.WaitGroup
+
+	cfg := r.config()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	workers := cfg.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	pids, err := readPids(&cfg)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan uint64)
+	results := make(chan ProcResult)
+
+	go func() {
+		defer close(jobs)
+		for _, pid := range pids {
+			// select picks at random when both are ready
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- pid:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// each worker needs its own buffer
+			cfg := cfg
+			for pid := range jobs {
+				result := ProcResult{Pid: pid}
+				result.Err = r.readProcInto(&cfg, pid, &result.Proc)
+				if errors.Is(result.Err, ErrProcessGone) {
+					continue
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		// fn may well have canceled ctx itself
+		err = ctx.Err()
+		if err != nil {
+			break
+		}
+		err = fn(result)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	// stop the workers and wait for them, so nothing's read after we return
+	cancel()
+	for range results {
+	}
+
+	return err
+}
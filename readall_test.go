@@ -0,0 +1,168 @@
+package procreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// manyFS returns testFS() with n more copies of process 15220, from 1000 up.
+func manyFS(n int) fstest.MapFS {
+	fsys := testFS()
+
+	for pid := 1000; pid < 1000+n; pid++ {
+		for _, name := range []string{"stat", "statm", "status", "cmdline", "environ"} {
+			fsys[fmt.Sprintf("%d/%s", pid, name)] = fsys["15220/"+name]
+		}
+	}
+
+	return fsys
+}
+
+func TestReadAll(t *testing.T) {
+	r := NewReader(manyFS(200))
+
+	pids, err := r.ListPids()
+	if err != nil {
+		t.Fatalf("ListPids(): %v\n", err)
+	}
+
+	read := make(map[uint64]ProcResult)
+	err = r.ReadAll(context.Background(), func(result ProcResult) error {
+		if _, ok := read[result.Pid]; ok {
+			return fmt.Errorf("%d read twice", result.Pid)
+		}
+		read[result.Pid] = result
+		return nil
+	}, Workers(4), Fields(Stat|Cmdline))
+	if err != nil {
+		t.Fatalf("ReadAll(): %v\n", err)
+	}
+	if len(read) != len(pids) {
+		t.Errorf("ReadAll(): read %d of %d processes\n", len(read), len(pids))
+	}
+	for _, pid := range pids {
+		result := read[pid]
+		if pid == 1 {
+			// only has a root directory
+			if result.Err == nil {
+				t.Errorf("ReadAll(): expected an error for 1\n")
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("ReadAll(): <%d> %v\n", pid, result.Err)
+			continue
+		}
+		expected := testCases[15220].expected
+		if tc, ok := testCases[pid]; ok {
+			expected = tc.expected
+		}
+		if !reflect.DeepEqual(result.Proc.Stat, expected.Stat) ||
+			!reflect.DeepEqual(result.Proc.Cmdline, expected.Cmdline) ||
+			result.Proc.Status.Pid != 0 {
+			t.Errorf("ReadAll(): <%d> actual != expected\n", pid)
+		}
+	}
+	if !t.Failed() {
+		fmt.Printf("ok ReadAll() read %d processes\n", len(read))
+	}
+
+	// an error from fn stops it
+	stop := errors.New("stop")
+	calls := 0
+	err = r.ReadAll(context.Background(), func(result ProcResult) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("ReadAll(stop): expected 1 call and stop, got %d and %v\n", calls, err)
+	} else {
+		fmt.Printf("ok ReadAll() stops when fn fails\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = r.ReadAll(ctx, func(result ProcResult) error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 0 {
+		t.Errorf("ReadAll(canceled): expected no calls and context.Canceled, got %d and %v\n", calls, err)
+	} else {
+		fmt.Printf("ok ReadAll() stops when ctx is done: %v\n", err)
+	}
+
+	// canceling from fn stops it too, even with more results already read
+	for _, workers := range []int{1, 8} {
+		ctx, cancel = context.WithCancel(context.Background())
+		calls = 0
+		err = r.ReadAll(ctx, func(result ProcResult) error {
+			calls++
+			cancel()
+			return nil
+		}, Workers(workers))
+		cancel()
+		if !errors.Is(err, context.Canceled) || calls != 1 {
+			t.Errorf("ReadAll(cancel in fn, %d workers): expected 1 call and context.Canceled, got %d and %v\n",
+				workers, calls, err)
+		} else {
+			fmt.Printf("ok ReadAll() with %d workers stops when fn cancels ctx\n", workers)
+		}
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	var wg sync.WaitGroup
+
+	r := NewReader(manyFS(50))
+
+	// a Reader (and so the package-level functions) can be used from several
+	// goroutines at once, which go test -race checks
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			count := 0
+			err := r.ReadAll(context.Background(), func(result ProcResult) error {
+				count++
+				return nil
+			}, Workers(3))
+			if err == nil && count != 53 {
+				err = fmt.Errorf("ReadAll(): read %d processes, expected 53", count)
+			}
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			var proc Proc
+			for pid := uint64(1000); pid < 1050; pid++ {
+				err := r.ReadProcInto(pid, &proc)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			// the real /proc, through the package-level functions
+			err := ReadAll(context.Background(), func(result ProcResult) error {
+				return result.Err
+			}, Fields(Stat|Statm))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("%v\n", err)
+		}
+	}
+	fmt.Printf("ok concurrent ReadAll() and ReadProcInto()\n")
+}
@@ -0,0 +1,214 @@
+package procreader
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reader reads process information from a proc filesystem, which can be the
+// host's /proc, another mount of it (eg. os.DirFS("/host/proc")), or a copy
+// such as an fstest.MapFS or the contents of a tarball. The package-level
+// functions use a Reader for /proc. A Reader is safe for use from multiple
+// goroutines, so the package-level functions are too (but not the values they
+// return, like a *PsFormatter, unless they say so).
+type Reader struct {
+	fsys    fs.FS
+	sysfs   fs.FS  // the root filesystem, for /dev and /etc
+	sysroot string // its name, for errors
+
+	// the boot time and clock ticks don't change, so are only read once
+	// (or until they're read without an error)
+	clockMu    sync.Mutex
+	clockRead  bool
+	clockBoot  time.Time
+	clockTicks uint64
+
+	ttys ttyDriverCache
+
+	bufs sync.Pool // of *[]byte, for procConfig.buf
+}
+
+// buffers bigger than this (eg. from a huge environ) aren't kept in the pool
+const maxPooledBuffer = 64 * 1024
+
+// readLinkFS is implemented by filesystems that can read symbolic links (the
+// same method as fs.ReadLinkFS in newer versions of Go). Without it, the
+// /proc/<pid>/fd links can't be read, so Sockets() and SocketOwners() return
+// an error matching errors.ErrUnsupported and TtyName() does without them.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// dirFS is the filesystem for a directory on the host, like os.DirFS() but
+// with ReadLink() and errors that include the full path.
+type dirFS string
+
+func (dir dirFS) path(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		name = ""
+	}
+	return strings.TrimRight(string(dir), "/") + "/" + name, nil
+}
+
+func (dir dirFS) Open(name string) (fs.File, error) {
+	path, err := dir.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (dir dirFS) ReadFile(name string) ([]byte, error) {
+	path, err := dir.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (dir dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := dir.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+// Stat is os.Stat(), so that fs.Stat() doesn't open the file: opening a
+// terminal (eg. to see whether it's the one we want) can make it ours.
+func (dir dirFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := dir.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+func (dir dirFS) ReadLink(name string) (string, error) {
+	path, err := dir.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+func (dir dirFS) Sub(name string) (fs.FS, error) {
+	path, err := dir.path("sub", name)
+	if err != nil {
+		return nil, err
+	}
+	return dirFS(path), nil
+}
+
+// Option changes where a Reader reads from, see New() and NewReader().
+type Option func(r *Reader)
+
+// This function returns an Option which reads the proc filesystem from dir
+// instead of /proc, eg. "/host/proc" when the host's is mounted there in a
+// container. All files are read from there, including the system-wide ones
+// like uptime, meminfo, stat and net/.
+func WithRoot(dir string) Option {
+	return func(r *Reader) {
+		r.fsys = dirFS(dir)
+	}
+}
+
+// This function returns an Option which uses dir (eg. "/host") instead of / as
+// the root filesystem for the files that aren't in proc: the devices in /dev
+// for terminal names and /etc/passwd and /etc/group for the user and group
+// names of NewPsFormatter().
+func WithSysRoot(dir string) Option {
+	return func(r *Reader) {
+		r.sysfs = dirFS(dir)
+		r.sysroot = dir
+	}
+}
+
+// This function returns an Option which is WithSysRoot() for a root
+// filesystem that isn't a directory on the host, eg. an fstest.MapFS with
+// "dev/pts/0" and "etc/passwd".
+func WithSysRootFS(fsys fs.FS) Option {
+	return func(r *Reader) {
+		r.sysfs = fsys
+		r.sysroot = "."
+	}
+}
+
+var defaultReader = New()
+
+// This function returns a Reader for /proc with / as the root filesystem,
+// unless opts say otherwise. When an option is given more than once, the last
+// one wins.
+func New(opts ...Option) *Reader {
+	return NewReader(dirFS("/proc"), opts...)
+}
+
+// This function returns a Reader for the proc filesystem fsys, with paths
+// like "<pid>/stat" and "uptime". If fsys also has a ReadLink(name) method
+// (like os.DirFS and fstest.MapFS in Go 1.25), the fd links are read too.
+func NewReader(fsys fs.FS, opts ...Option) *Reader {
+	var r Reader
+
+	r.fsys = fsys
+	r.sysfs = dirFS("/")
+	r.sysroot = "/"
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	return &r
+}
+
+// config returns a procConfig for reading from r. It doesn't cache contents,
+// callers that want that should set cfg.contents.
+func (r *Reader) config() procConfig {
+	var cfg procConfig
+
+	cfg.fsys = r.fsys
+	cfg.devfs, _ = fs.Sub(r.sysfs, "dev")
+	cfg.ttyDrivers = &r.ttys
+
+	return cfg
+}
+
+// readFile returns the contents of name in cfg.fsys.
+func readFile(cfg *procConfig, name string) ([]byte, error) {
+	return fs.ReadFile(cfg.fsys, name)
+}
+
+// readDir returns the entries in the directory name in cfg.fsys, sorted by
+// name.
+func readDir(cfg *procConfig, name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(cfg.fsys, name)
+}
+
+// readLink returns the target of the symbolic link name in cfg.fsys.
+func readLink(cfg *procConfig, name string) (string, error) {
+	if fsys, ok := cfg.fsys.(readLinkFS); ok {
+		return fsys.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+// getBuffer returns a buffer from r's pool, which the caller gives back with
+// putBuffer() when it's done with it.
+func (r *Reader) getBuffer() *[]byte {
+	if buf, ok := r.bufs.Get().(*[]byte); ok {
+		return buf
+	}
+	return new([]byte)
+}
+
+func (r *Reader) putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	r.bufs.Put(buf)
+}
@@ -0,0 +1,328 @@
+package procreader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testFS returns a proc filesystem with the processes from testCases (except
+// the 2.6.18 one, which has no audit or attr files either way).
+func testFS() fstest.MapFS {
+	fsys := fstest.MapFS{
+		"stat":              {Data: []byte("cpu  100 0 100 800 0 0 0 0 0 0\nbtime 1425987800\n")},
+		"uptime":            {Data: []byte("1000.50 1900.00\n")},
+		"self":              {Mode: os.ModeDir},
+		"1/root/etc/passwd": {Data: []byte("root:x:0:0:root:/root:/bin/sh\nnginx:x:101:101::/:/sbin/nologin\n")},
+	}
+
+	for _, pid := range []uint64{15220, 29821} {
+		tc := testCases[pid]
+		fsys[fmt.Sprintf("%d/stat", pid)] = &fstest.MapFile{Data: []byte(tc.statContent)}
+		fsys[fmt.Sprintf("%d/statm", pid)] = &fstest.MapFile{Data: []byte(tc.statmContent)}
+		fsys[fmt.Sprintf("%d/status", pid)] = &fstest.MapFile{Data: []byte(tc.statusContent)}
+		fsys[fmt.Sprintf("%d/cmdline", pid)] = &fstest.MapFile{Data: []byte(tc.cmdlineContent)}
+		fsys[fmt.Sprintf("%d/environ", pid)] = &fstest.MapFile{Data: []byte(tc.environContent)}
+	}
+
+	return fsys
+}
+
+func TestReaderFS(t *testing.T) {
+	r := NewReader(testFS())
+
+	pids, err := r.ListPids()
+	if err != nil {
+		t.Fatalf("ListPids(): %v\n", err)
+	}
+	// "1" only has a root directory, but it's still a process as far as we know
+	if !reflect.DeepEqual(pids, []uint64{1, 15220, 29821}) {
+		t.Errorf("ListPids(): unexpected %v\n", pids)
+	} else {
+		fmt.Printf("ok ListPids() == %v\n", pids)
+	}
+
+	for _, pid := range []uint64{15220, 29821} {
+		proc, contents, err := r.ReadProcData(pid)
+		if err != nil {
+			t.Errorf("ReadProcData(%d): %v\n", pid, err)
+			continue
+		}
+		expected := testCases[pid].expected
+		if !reflect.DeepEqual(proc.Stat, expected.Stat) ||
+			!reflect.DeepEqual(proc.Cmdline, expected.Cmdline) {
+			t.Errorf("ReadProcData(%d): actual != expected\n", pid)
+			continue
+		}
+		if contents["stat"] != testCases[pid].statContent {
+			t.Errorf("ReadProcData(%d): stat contents not returned\n", pid)
+			continue
+		}
+		fmt.Printf("ok ReadProcData(%d) from fs.FS\n", pid)
+	}
+
+	_, err = r.ReadProc(2)
+	if err == nil || !isUnavailable(err) {
+		t.Errorf("ReadProc(2): expected missing, got %v\n", err)
+	} else {
+		fmt.Printf("ok ReadProc(2) fails: %v\n", err)
+	}
+
+	hz, err := r.ClockTicks()
+	if err != nil || hz != defaultClockTicks {
+		t.Errorf("ClockTicks(): expected %d, got %d (%v)\n", defaultClockTicks, hz, err)
+	} else {
+		fmt.Printf("ok ClockTicks() == %d without auxv\n", hz)
+	}
+	boot, err := r.BootTime()
+	if err != nil || !boot.Equal(time.Unix(1425987800, 0)) {
+		t.Errorf("BootTime(): unexpected %v (%v)\n", boot, err)
+	} else {
+		fmt.Printf("ok BootTime() == %d\n", boot.Unix())
+	}
+
+	name, err := r.NewProcResolver(1).UserName(101)
+	if err != nil || name != "nginx" {
+		t.Errorf("NewProcResolver(1): expected 'nginx', got '%s' (%v)\n", name, err)
+	} else {
+		fmt.Printf("ok NewProcResolver(1) == %s\n", name)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	var cfg procConfig
+
+	dir, err := ioutil.TempDir("", "procreader")
+	if err != nil {
+		t.Fatalf("TempDir(): %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "42/fd"), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll(): %v\n", err)
+	}
+	err = os.Symlink("socket:[1234]", filepath.Join(dir, "42/fd/3"))
+	if err != nil {
+		t.Fatalf("Symlink(): %v\n", err)
+	}
+
+	cfg.fsys = dirFS(dir + "/")
+
+	inodes, err := readSocketInodes(&cfg, 42)
+	if err != nil || !reflect.DeepEqual(inodes, []uint64{1234}) {
+		t.Errorf("readSocketInodes(): unexpected %v (%v)\n", inodes, err)
+	} else {
+		fmt.Printf("ok readSocketInodes() == %v through dirFS\n", inodes)
+	}
+
+	// fs.FS names are relative, so we can't be tricked into leaving dir
+	_, err = readFile(&cfg, "../etc/passwd")
+	if err == nil {
+		t.Errorf("readFile(../etc/passwd): expected an error\n")
+	} else {
+		fmt.Printf("ok readFile(../etc/passwd) fails: %v\n", err)
+	}
+
+	// without ReadLink() the links can't be read at all
+	cfg.fsys = fstest.MapFS{"42/fd/3": {Data: []byte("not a link")}}
+	_, err = readLink(&cfg, "42/fd/3")
+	if err == nil {
+		t.Errorf("readLink(): expected an error\n")
+	} else {
+		fmt.Printf("ok readLink() fails: %v\n", err)
+	}
+}
+
+func TestReaderOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procreader")
+	if err != nil {
+		t.Fatalf("TempDir(): %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a host with its proc at <dir>/host/proc, like a monitoring container sees
+	files := map[string]string{
+		"host/proc/stat":    "cpu  100 0 100 800 0 0 0 0 0 0\nbtime 1425987800\n",
+		"host/proc/uptime":  "1000.50 1900.00\n",
+		"host/proc/meminfo": "MemTotal:        1000000 kB\n",
+		"host/etc/passwd":   "root:x:0:0:root:/root:/bin/sh\nhostuser:x:1000:1000::/:/bin/sh\n",
+		"host/etc/group":    "root:x:0:\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(contents), 0644)
+		}
+		if err != nil {
+			t.Fatalf("WriteFile(%s): %v\n", name, err)
+		}
+	}
+
+	r := New(WithRoot(filepath.Join(dir, "host/proc")), WithSysRoot(filepath.Join(dir, "host")))
+
+	cfg := r.config()
+	if cfg.devfs != dirFS(filepath.Join(dir, "host/dev")) {
+		t.Errorf("config(): unexpected devfs '%v'\n", cfg.devfs)
+	} else {
+		fmt.Printf("ok devfs == <sysroot>/dev\n")
+	}
+
+	f, err := r.NewPsFormatter("pid,user")
+	if err != nil {
+		t.Fatalf("NewPsFormatter(): %v\n", err)
+	}
+	if f.Uptime != 1000.50 || f.MemTotal != 1000000 || f.BootTime.Unix() != 1425987800 {
+		t.Errorf("NewPsFormatter(): system values not from root: %v %v %v\n",
+			f.Uptime, f.MemTotal, f.BootTime)
+	} else {
+		fmt.Printf("ok NewPsFormatter() reads uptime, meminfo and stat from root\n")
+	}
+	name, err := f.Resolver.UserName(1000)
+	if err != nil || name != "hostuser" {
+		t.Errorf("UserName(1000): expected 'hostuser', got '%s' (%v)\n", name, err)
+	} else {
+		fmt.Printf("ok UserName(1000) == %s from sysroot\n", name)
+	}
+
+	// the last option wins
+	r = NewReader(testFS(), WithRoot("/nonexistent/path"))
+	_, err = r.ListPids()
+	if err == nil || !isUnavailable(err) {
+		t.Errorf("ListPids(): expected missing root, got %v\n", err)
+	} else {
+		fmt.Printf("ok WithRoot() replaces fsys: %v\n", err)
+	}
+
+	// a root filesystem that's only in memory
+	sysfs := fstest.MapFS{
+		"dev/pts/0":  ttyDevice(136, 0),
+		"etc/passwd": {Data: []byte("memuser:x:1000:1000::/:/bin/sh\n")},
+	}
+	proc := fstest.MapFS{
+		"stat":        {Data: []byte("cpu  100 0 100 800 0 0 0 0 0 0\nbtime 1425987800\n")},
+		"uptime":      {Data: []byte("1000.50 1900.00\n")},
+		"meminfo":     {Data: []byte("MemTotal:        1000000 kB\n")},
+		"tty/drivers": {Data: []byte("pty_slave /dev/pts 136 0-1048575 pty:slave\n")},
+	}
+	f, err = NewReader(proc, WithSysRootFS(sysfs)).NewPsFormatter("user,tty")
+	if err != nil {
+		t.Fatalf("NewPsFormatter(): %v\n", err)
+	}
+	var shell Proc
+	shell.Stat.Tty_nr = 136 << 8
+	shell.Status.Uid.Effective = 1000
+	row, err := f.Row(&shell)
+	if err != nil || !reflect.DeepEqual(row, []string{"memuser", "pts/0"}) {
+		t.Errorf("Row(): expected memuser on pts/0, got %q (%v)\n", row, err)
+	} else {
+		fmt.Printf("ok WithSysRootFS() gives %q\n", row)
+	}
+}
+
+func TestReadProcInto(t *testing.T) {
+	var proc Proc
+
+	r := NewReader(testFS())
+
+	for _, pid := range []uint64{29821, 15220, 29821} {
+		cmdline := proc.Cmdline[:cap(proc.Cmdline)]
+		environ := proc.Environ[:cap(proc.Environ)]
+
+		err := r.ReadProcInto(pid, &proc)
+		if err != nil {
+			t.Errorf("ReadProcInto(%d): %v\n", pid, err)
+			continue
+		}
+		expected := testCases[pid].expected
+		if !reflect.DeepEqual(proc.Stat, expected.Stat) ||
+			!reflect.DeepEqual(proc.Status, expected.Status) ||
+			!reflect.DeepEqual(proc.Cmdline, expected.Cmdline) ||
+			!reflect.DeepEqual(proc.Environ, expected.Environ) {
+			t.Errorf("ReadProcInto(%d): actual != expected\n", pid)
+			continue
+		}
+		// 29821 has more of both than 15220, so the first read has the room
+		if len(cmdline) > 0 && &proc.Cmdline[0] != &cmdline[0] ||
+			len(environ) > 0 && &proc.Environ[0] != &environ[0] {
+			t.Errorf("ReadProcInto(%d): slices weren't reused\n", pid)
+			continue
+		}
+		fmt.Printf("ok ReadProcInto(%d) reusing slices\n", pid)
+	}
+
+	// what isn't read is emptied
+	err := r.ReadProcInto(15220, &proc, Fields(Stat))
+	if err != nil || proc.Stat.Pid != 15220 || len(proc.Cmdline) != 0 || len(proc.Status.Groups) != 0 {
+		t.Errorf("ReadProcInto(Stat): unexpected %v %v (%v)\n", proc.Cmdline, proc.Status.Groups, err)
+	} else {
+		fmt.Printf("ok ReadProcInto(Stat) empties the rest\n")
+	}
+
+	_, contents, err := r.ReadProcData(15220, NoContents())
+	if err != nil || contents != nil {
+		t.Errorf("ReadProcData(NoContents()): unexpected %v (%v)\n", contents, err)
+	} else {
+		fmt.Printf("ok ReadProcData(NoContents()) keeps no contents\n")
+	}
+}
+
+func benchmarkReader(b *testing.B, read func(r *Reader, proc *Proc) error) {
+	var proc Proc
+
+	dir, err := ioutil.TempDir("", "procreader")
+	if err != nil {
+		b.Fatalf("TempDir(): %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// real files, so it's the reading that's measured rather than the MapFS
+	tc := testCases[29821]
+	files := map[string]string{
+		"stat":    tc.statContent,
+		"statm":   tc.statmContent,
+		"status":  tc.statusContent,
+		"cmdline": tc.cmdlineContent,
+		"environ": tc.environContent,
+	}
+	err = os.Mkdir(filepath.Join(dir, "29821"), 0755)
+	for name, contents := range files {
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "29821", name), []byte(contents), 0644)
+		}
+	}
+	if err != nil {
+		b.Fatalf("WriteFile(): %v\n", err)
+	}
+
+	r := New(WithRoot(dir))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := read(r, &proc)
+		if err != nil {
+			b.Fatalf("%v\n", err)
+		}
+	}
+}
+
+func BenchmarkReadProcData(b *testing.B) {
+	benchmarkReader(b, func(r *Reader, proc *Proc) error {
+		var err error
+		*proc, _, err = r.ReadProcData(29821, Fields(Stat|Statm|Status|Cmdline|Environ))
+		return err
+	})
+}
+
+func BenchmarkReadProcInto(b *testing.B) {
+	benchmarkReader(b, func(r *Reader, proc *Proc) error {
+		return r.ReadProcInto(29821, proc, Fields(Stat|Statm|Status|Cmdline|Environ))
+	})
+}
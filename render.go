@@ -0,0 +1,319 @@
+package procreader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// TreeOptions controls the output of RenderTree(). The zero value gives the
+// same output as a plain 'pstree -A'.
+type TreeOptions struct {
+	Unicode     bool      // use Unicode line drawing characters instead of ASCII (pstree -U)
+	ShowPids    bool      // show PIDs after names, disables compaction (pstree -p)
+	ShowUids    bool      // show UID transitions (pstree -u)
+	Args        bool      // show command line arguments, disables compaction (pstree -a)
+	NoCompact   bool      // don't compact identical subtrees (pstree -c)
+	HideThreads bool      // don't show threads (pstree -T)
+	SortByPid   bool      // sort children by PID instead of name (pstree -n)
+	Resolver    *Resolver // if set, UIDs are shown as user names
+
+	// ProcResolver, if set, returns the Resolver for each process instead
+	// of Resolver, eg. ProcResolvers.Resolver for the names in its
+	// container. Where it returns nil, Resolver is used.
+	ProcResolver func(proc *Proc) *Resolver
+}
+
+type treeChars struct {
+	single string // "───": the only child
+	first  string // "─┬─": first of several children
+	middle string // "├─"
+	last   string // "└─"
+	bar    string // "│"
+}
+
+var asciiChars = treeChars{"---", "-+-", "|-", "`-", "|"}
+var unicodeChars = treeChars{"───", "─┬─", "├─", "└─", "│"}
+
+// a node or thread group to be rendered, after sorting and compaction
+type renderItem struct {
+	node  *ProcNode // nil for threads
+	label string    // used for threads, and for sorting
+	count int       // > 1 when compacted
+	lines []string  // node's rendering, if compactKey() has done it already
+}
+
+func (opts *TreeOptions) chars() treeChars {
+	if opts.Unicode {
+		return unicodeChars
+	}
+	return asciiChars
+}
+
+func (opts *TreeOptions) label(node *ProcNode) (string, error) {
+	var extra []string
+	var args []string
+
+	name := node.Proc.Stat.Tcomm
+	if opts.Args && len(node.Proc.Cmdline) > 1 {
+		args = node.Proc.Cmdline[1:]
+	}
+
+	if opts.ShowPids {
+		extra = append(extra, fmt.Sprintf("%d", node.Proc.Stat.Pid))
+	}
+	if opts.ShowUids && node.Parent != nil &&
+		node.Parent.Proc.Status.Uid.Real != node.Proc.Status.Uid.Real {
+		uid := fmt.Sprintf("%d", node.Proc.Status.Uid.Real)
+		resolver := opts.Resolver
+		if opts.ProcResolver != nil {
+			if procResolver := opts.ProcResolver(node.Proc); procResolver != nil {
+				resolver = procResolver
+			}
+		}
+		if resolver != nil {
+			var err error
+			uid, err = resolver.UserName(node.Proc.Status.Uid.Real)
+			if err != nil {
+				return "", wrapError(err)
+			}
+		}
+		extra = append(extra, uid)
+	}
+
+	if len(extra) > 0 {
+		if opts.Args {
+			// pstree -a uses "name,pid,uid args"
+			name = name + "," + strings.Join(extra, ",")
+		} else {
+			name = fmt.Sprintf("%s(%s)", name, strings.Join(extra, ","))
+		}
+	}
+	if len(args) > 0 {
+		name = name + " " + strings.Join(args, " ")
+	}
+
+	return name, nil
+}
+
+// items returns what should be rendered beneath node: its children, then its
+// threads, with identical siblings merged unless compaction is disabled.
+func (opts *TreeOptions) items(node *ProcNode) ([]renderItem, error) {
+	var items []renderItem
+
+	for _, child := range node.Children {
+		label, err := opts.label(child)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		items = append(items, renderItem{node: child, label: label, count: 1})
+	}
+	if !opts.SortByPid {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].label < items[j].label
+		})
+	}
+
+	if !opts.HideThreads && node.Proc.Stat.Num_threads > 1 {
+		items = append(items, renderItem{
+			label: "{" + node.Proc.Stat.Tcomm + "}",
+			count: int(node.Proc.Stat.Num_threads) - 1,
+		})
+	}
+
+	if opts.NoCompact || opts.ShowPids || opts.Args {
+		// threads are always compacted unless asked not to be
+		if opts.NoCompact && len(items) > 0 && items[len(items)-1].node == nil {
+			thread := items[len(items)-1]
+			items = items[:len(items)-1]
+			for i := 0; i < thread.count; i++ {
+				items = append(items, renderItem{label: thread.label, count: 1})
+			}
+		}
+		return items, nil
+	}
+
+	// merge identical leaf siblings (including their single-child chains)
+	var compacted []renderItem
+	var keys []string
+	for i := range items {
+		key, err := opts.compactKey(&items[i])
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		if n := len(compacted); n > 0 && key != "" && keys[n-1] == key {
+			compacted[n-1].count += items[i].count
+			continue
+		}
+		compacted = append(compacted, items[i])
+		keys = append(keys, key)
+	}
+
+	return compacted, nil
+}
+
+// compactKey returns the single line rendering of item if it can be merged
+// with identical siblings, or "" if it can't (it has more than one child). The
+// rendering is kept in item.lines, so each node is only rendered once.
+func (opts *TreeOptions) compactKey(item *renderItem) (string, error) {
+	if item.node == nil {
+		return item.label, nil
+	}
+	lines, err := opts.render(item.node)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	item.lines = lines
+	if len(lines) != 1 {
+		return "", nil
+	}
+	return lines[0], nil
+}
+
+func (opts *TreeOptions) renderItem(item renderItem) ([]string, error) {
+	var lines []string
+
+	if item.node == nil {
+		lines = []string{item.label}
+	} else if item.lines != nil {
+		lines = item.lines
+	} else {
+		var err error
+		lines, err = opts.render(item.node)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	if item.count > 1 {
+		lines = []string{fmt.Sprintf("%d*[%s]", item.count, lines[0])}
+	}
+
+	return lines, nil
+}
+
+// render returns the lines for node and its descendants in pstree's default
+// layout, where the first child is on the same line as its parent.
+func (opts *TreeOptions) render(node *ProcNode) ([]string, error) {
+	var lines []string
+
+	chars := opts.chars()
+
+	label, err := opts.label(node)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	items, err := opts.items(node)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if len(items) == 0 {
+		return []string{label}, nil
+	}
+
+	pad := strings.Repeat(" ", utf8.RuneCountInString(label)+1)
+	for i, item := range items {
+		child, err := opts.renderItem(item)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		var first, rest string
+		switch {
+		case len(items) == 1:
+			first = label + chars.single
+			rest = strings.Repeat(" ", utf8.RuneCountInString(first))
+		case i == 0:
+			first = label + chars.first
+			rest = pad + chars.bar + " "
+		case i == len(items)-1:
+			first = pad + chars.last
+			rest = pad + "  "
+		default:
+			first = pad + chars.middle
+			rest = pad + chars.bar + " "
+		}
+
+		lines = append(lines, first+child[0])
+		for _, line := range child[1:] {
+			lines = append(lines, rest+line)
+		}
+	}
+
+	return lines, nil
+}
+
+// renderArgs returns the lines for node and its descendants in the layout used
+// by 'pstree -a', where every process is on its own line.
+func (opts *TreeOptions) renderArgs(node *ProcNode) ([]string, error) {
+	var lines []string
+
+	chars := opts.chars()
+
+	label, err := opts.label(node)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	items, err := opts.items(node)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	lines = append(lines, label)
+	for i, item := range items {
+		var child []string
+
+		if item.node == nil {
+			child, err = opts.renderItem(item)
+		} else {
+			child, err = opts.renderArgs(item.node)
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		first := "  " + chars.middle
+		rest := "  " + chars.bar + " "
+		if i == len(items)-1 {
+			first = "  " + chars.last
+			rest = "    "
+		}
+
+		lines = append(lines, first+child[0])
+		for _, line := range child[1:] {
+			lines = append(lines, rest+line)
+		}
+	}
+
+	return lines, nil
+}
+
+// This function writes a pstree(1) style rendering of the trees rooted at
+// roots (eg. BuildTree(procs).Roots, or a single node from Find()) to w.
+func RenderTree(w io.Writer, roots []*ProcNode, opts TreeOptions) error {
+	for _, root := range roots {
+		var lines []string
+		var err error
+
+		if opts.Args {
+			lines, err = opts.renderArgs(root)
+		} else {
+			lines, err = opts.render(root)
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+
+		for _, line := range lines {
+			_, err = fmt.Fprintln(w, line)
+			if err != nil {
+				return wrapError(err)
+			}
+		}
+	}
+
+	return nil
+}
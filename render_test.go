@@ -0,0 +1,170 @@
+package procreader
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func renderProc(pid uint64, ppid int64, comm string, threads uint32, uid uint64, cmdline ...string) Proc {
+	var proc Proc
+
+	proc.Stat = Stat_t{Pid: pid, Ppid: ppid, Tcomm: comm, Num_threads: threads}
+	proc.Status.Uid.Real = uid
+	proc.Cmdline = cmdline
+
+	return proc
+}
+
+func renderTestTree() *ProcTree {
+	return BuildTree([]Proc{
+		renderProc(1, 0, "systemd", 1, 0, "/sbin/init", "splash"),
+		renderProc(200, 1, "sshd", 1, 0, "sshd:", "/usr/sbin/sshd"),
+		renderProc(300, 200, "sshd", 1, 1000, "sshd:", "josh@pts/0"),
+		renderProc(301, 300, "bash", 1, 1000, "-bash"),
+		renderProc(400, 1, "agetty", 1, 0, "/sbin/agetty", "tty1"),
+		renderProc(401, 1, "agetty", 1, 0, "/sbin/agetty", "tty2"),
+		renderProc(500, 1, "containerd", 5, 0, "/usr/bin/containerd"),
+		renderProc(2, 0, "kthreadd", 1, 0),
+		renderProc(3, 2, "kworker/0:0", 1, 0),
+	})
+}
+
+func TestRenderTree(t *testing.T) {
+	host := newFSResolver(fstest.MapFS{"etc/passwd": {Data: []byte("josh:x:1000:1000::/home/josh:/bin/sh\n")}})
+	container := newFSResolver(fstest.MapFS{"etc/passwd": {Data: []byte("app:x:1000:1000::/app:/bin/sh\n")}})
+	procResolver := func(proc *Proc) *Resolver {
+		if proc.Stat.Pid == 300 {
+			return container
+		}
+		return host
+	}
+
+	var tests = []struct {
+		name   string
+		pid    uint64
+		opts   TreeOptions
+		expect string
+	}{
+		{"default", 1, TreeOptions{},
+			"systemd-+-2*[agetty]\n" +
+				"        |-containerd---4*[{containerd}]\n" +
+				"        `-sshd---sshd---bash\n"},
+		{"unicode", 1, TreeOptions{Unicode: true},
+			"systemd─┬─2*[agetty]\n" +
+				"        ├─containerd───4*[{containerd}]\n" +
+				"        └─sshd───sshd───bash\n"},
+		{"pids", 1, TreeOptions{ShowPids: true, HideThreads: true},
+			"systemd(1)-+-agetty(400)\n" +
+				"           |-agetty(401)\n" +
+				"           |-containerd(500)\n" +
+				"           `-sshd(200)---sshd(300)---bash(301)\n"},
+		{"uids", 200, TreeOptions{ShowUids: true},
+			"sshd---sshd(1000)---bash\n"},
+		{"user names", 200, TreeOptions{ShowUids: true, Resolver: host},
+			"sshd---sshd(josh)---bash\n"},
+		{"user names per process", 200, TreeOptions{ShowUids: true, ProcResolver: procResolver},
+			"sshd---sshd(app)---bash\n"},
+		{"user names falling back", 200, TreeOptions{ShowUids: true, Resolver: host,
+			ProcResolver: func(proc *Proc) *Resolver { return nil }},
+			"sshd---sshd(josh)---bash\n"},
+		{"sorted by pid", 1, TreeOptions{SortByPid: true, HideThreads: true},
+			"systemd-+-sshd---sshd---bash\n" +
+				"        |-2*[agetty]\n" +
+				"        `-containerd\n"},
+		{"no compaction", 500, TreeOptions{NoCompact: true},
+			"containerd-+-{containerd}\n" +
+				"           |-{containerd}\n" +
+				"           |-{containerd}\n" +
+				"           `-{containerd}\n"},
+		{"args", 1, TreeOptions{Args: true},
+			"systemd splash\n" +
+				"  |-agetty tty1\n" +
+				"  |-agetty tty2\n" +
+				"  |-containerd\n" +
+				"  |   `-4*[{containerd}]\n" +
+				"  `-sshd /usr/sbin/sshd\n" +
+				"      `-sshd josh@pts/0\n" +
+				"          `-bash\n"},
+		{"args and pids", 200, TreeOptions{Args: true, ShowPids: true},
+			"sshd,200 /usr/sbin/sshd\n" +
+				"  `-sshd,300 josh@pts/0\n" +
+				"      `-bash,301\n"},
+	}
+
+	tree := renderTestTree()
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		err := RenderTree(&buf, []*ProcNode{tree.Find(test.pid)}, test.opts)
+		if err != nil {
+			t.Errorf("RenderTree(%s): %v\n", test.name, err)
+			continue
+		}
+		if buf.String() != test.expect {
+			t.Errorf("RenderTree(%s): expected:\n%s\ngot:\n%s\n", test.name, test.expect, buf.String())
+			continue
+		}
+		fmt.Printf("ok RenderTree(%s)\n", test.name)
+	}
+}
+
+func TestRenderTreeRoots(t *testing.T) {
+	var buf bytes.Buffer
+
+	expect := "systemd---sshd---sshd---bash\n" +
+		"kthreadd---kworker/0:0\n"
+
+	tree := BuildTree([]Proc{
+		renderProc(1, 0, "systemd", 1, 0),
+		renderProc(200, 1, "sshd", 1, 0),
+		renderProc(300, 200, "sshd", 1, 1000),
+		renderProc(301, 300, "bash", 1, 1000),
+		renderProc(2, 0, "kthreadd", 1, 0),
+		renderProc(3, 2, "kworker/0:0", 1, 0),
+	})
+	err := RenderTree(&buf, tree.Roots, TreeOptions{})
+	if err != nil {
+		t.Errorf("RenderTree(): %v\n", err)
+		return
+	}
+	if buf.String() != expect {
+		t.Errorf("RenderTree(): expected:\n%s\ngot:\n%s\n", expect, buf.String())
+		return
+	}
+	fmt.Printf("ok RenderTree(roots)\n")
+}
+
+func TestRenderTreeDeep(t *testing.T) {
+	var buf bytes.Buffer
+	var procs []Proc
+
+	// a long pipeline, like make running sh running make..., ending in two cc
+	depth := 40
+	for pid := 1; pid <= depth; pid++ {
+		procs = append(procs, renderProc(uint64(pid), int64(pid-1), "sh", 1, 0))
+	}
+	procs = append(procs, renderProc(uint64(depth+1), int64(depth), "cc", 1, 0))
+	procs = append(procs, renderProc(uint64(depth+2), int64(depth), "cc", 1, 0))
+	expect := strings.Repeat("sh---", depth-1) + "sh---2*[cc]\n"
+
+	start := time.Now()
+	err := RenderTree(&buf, BuildTree(procs).Roots, TreeOptions{})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("RenderTree(): %v\n", err)
+	}
+	if buf.String() != expect {
+		t.Errorf("RenderTree(): expected:\n%s\ngot:\n%s\n", expect, buf.String())
+		return
+	}
+	// rendering each level twice would take hours at this depth
+	if elapsed > time.Second {
+		t.Errorf("RenderTree(): depth %d took %v\n", depth, elapsed)
+		return
+	}
+	fmt.Printf("ok RenderTree(depth %d) in %v\n", depth, elapsed)
+}
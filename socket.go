@@ -0,0 +1,368 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Socket_t struct {
+	// fields from a line of /proc/net/{tcp,tcp6,udp,udp6,raw,raw6,unix}
+
+	Proto      string   // "tcp", "tcp6", "udp", "udp6", "raw", "raw6" or "unix"
+	Local_addr net.IP   // local address (nil for unix)
+	Local_port uint16   // local port (protocol number for raw)
+	Rem_addr   net.IP   // remote address (nil for unix)
+	Rem_port   uint16   // remote port
+	State      string   // eg. "LISTEN" or "ESTABLISHED" (like ss(8))
+	Tx_queue   uint64   // bytes in the send queue
+	Rx_queue   uint64   // bytes in the receive queue
+	Uid        uint64   // effective UID of the creator of the socket (0 for unix)
+	Inode      uint64   // inode of the socket, matches 'socket:[<inode>]' in /proc/<pid>/fd
+	Type       string   // "stream", "dgram" or "seqpacket" (unix only)
+	Path       string   // bound path, '@' prefixed if abstract (unix only)
+	Pids       []uint64 // processes with this socket open
+}
+
+// the protocols we read and the files they come from under /proc/<pid>/net/
+var socketProtos = []string{"tcp", "tcp6", "udp", "udp6", "raw", "raw6", "unix"}
+
+// include/net/tcp_states.h
+var tcpStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0a: "LISTEN",
+	0x0b: "CLOSING",
+	0x0c: "NEW_SYN_RECV",
+}
+
+// include/uapi/linux/net.h socket_state
+var unixStates = map[uint64]string{
+	0x00: "FREE",
+	0x01: "UNCONNECTED",
+	0x02: "CONNECTING",
+	0x03: "CONNECTED",
+	0x04: "DISCONNECTING",
+}
+
+var unixTypes = map[uint64]string{
+	0x0001: "stream",
+	0x0002: "dgram",
+	0x0005: "seqpacket",
+}
+
+// __SO_ACCEPTCON from include/linux/net.h, set on listening unix sockets
+const unixAcceptCon = 0x10000
+
+// parseInetAddr decodes the "<hex address>:<hex port>" format used in
+// /proc/net/{tcp,udp,raw}[6]. Like parseHexIP(), errors are for the caller to
+// make a parseError() of.
+func parseInetAddr(s string) (net.IP, uint16, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("bad address '%s'", s)
+	}
+
+	ip, err := parseHexIP(parts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ip, uint16(port), nil
+}
+
+func parseInetSocket(proto string, line string) (Socket_t, error) {
+	var sock Socket_t
+	var err error
+
+	//  sl  local_address rem_address   st tx_queue:rx_queue tr:tm->when retrnsmt   uid  timeout inode ...
+	file := "net/" + proto
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return sock, parseError(file, 0, "", fmt.Errorf("unexpected format: '%s'", line))
+	}
+
+	sock.Proto = proto
+	sock.Local_addr, sock.Local_port, err = parseInetAddr(fields[1])
+	if err != nil {
+		return sock, parseError(file, 0, "Local_addr", err)
+	}
+	sock.Rem_addr, sock.Rem_port, err = parseInetAddr(fields[2])
+	if err != nil {
+		return sock, parseError(file, 0, "Rem_addr", err)
+	}
+
+	st, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return sock, parseError(file, 0, "State", err)
+	}
+	sock.State = tcpStates[st]
+	if !strings.HasPrefix(proto, "tcp") && st == 0x07 {
+		// not connected, which is how ss shows it
+		sock.State = "UNCONN"
+	}
+
+	queues := strings.SplitN(fields[4], ":", 2)
+	if len(queues) != 2 {
+		return sock, parseError(file, 0, "Tx_queue", fmt.Errorf("bad queues '%s'", fields[4]))
+	}
+	sock.Tx_queue, err = strconv.ParseUint(queues[0], 16, 64)
+	if err != nil {
+		return sock, parseError(file, 0, "Tx_queue", err)
+	}
+	sock.Rx_queue, err = strconv.ParseUint(queues[1], 16, 64)
+	if err != nil {
+		return sock, parseError(file, 0, "Rx_queue", err)
+	}
+
+	sock.Uid, err = strconv.ParseUint(fields[7], 10, 64)
+	if err != nil {
+		return sock, parseError(file, 0, "Uid", err)
+	}
+	sock.Inode, err = strconv.ParseUint(fields[9], 10, 64)
+	if err != nil {
+		return sock, parseError(file, 0, "Inode", err)
+	}
+
+	return sock, nil
+}
+
+// the columns of /proc/net/unix parseUnixSocket() parses, for errors
+var unixFields = [...]string{"RefCount", "Protocol", "Flags", "Type", "St", "Inode"}
+
+func parseUnixSocket(line string) (Socket_t, error) {
+	var sock Socket_t
+	var err error
+	var values [6]uint64
+
+	// Num       RefCount Protocol Flags    Type St Inode Path
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return sock, parseError("net/unix", 0, "", fmt.Errorf("unexpected format: '%s'", line))
+	}
+	for i := range values {
+		base := 16
+		if i == 5 {
+			// inode is decimal, everything else is hex
+			base = 10
+		}
+		values[i], err = strconv.ParseUint(fields[i+1], base, 64)
+		if err != nil {
+			return sock, parseError("net/unix", 0, unixFields[i], err)
+		}
+	}
+
+	sock.Proto = "unix"
+	sock.Type = unixTypes[values[3]]
+	sock.State = unixStates[values[4]]
+	if values[2]&unixAcceptCon != 0 {
+		sock.State = "LISTEN"
+	}
+	sock.Inode = values[5]
+	if len(fields) > 7 {
+		// the kernel doesn't escape paths, so they can contain spaces
+		sock.Path = strings.Join(fields[7:], " ")
+	}
+
+	return sock, nil
+}
+
+// parseSocketTable parses all of the sockets for proto from lines (the
+// contents of one of the /proc/net files).
+func parseSocketTable(proto string, lines []string) ([]Socket_t, error) {
+	var socks []Socket_t
+
+	// first line is the header
+	for i := 1; i < len(lines); i++ {
+		var sock Socket_t
+		var err error
+
+		if proto == "unix" {
+			sock, err = parseUnixSocket(lines[i])
+		} else {
+			sock, err = parseInetSocket(proto, lines[i])
+		}
+		if err != nil {
+			return nil, atLine(err, i+1)
+		}
+		socks = append(socks, sock)
+	}
+
+	return socks, nil
+}
+
+// readSockets reads all of the /proc/<pid>/net/ socket tables (/proc/net/ if
+// pid is 0).
+func readSockets(cfg *procConfig, pid uint64) ([]Socket_t, error) {
+	var socks []Socket_t
+	var found bool
+	var missing error
+
+	for _, proto := range socketProtos {
+		lines, err := readNetLines(cfg, pid, proto)
+		if err != nil {
+			// eg. no IPv6
+			if isUnavailable(err) {
+				missing = err
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		found = true
+		table, err := parseSocketTable(proto, lines)
+		if err != nil {
+			return nil, withContext(err, pid, "net/"+proto)
+		}
+		socks = append(socks, table...)
+	}
+	// there's always tcp and unix, so none at all means the process exited
+	if !found && missing != nil {
+		return nil, wrapError(missing)
+	}
+
+	return socks, nil
+}
+
+// readSocketInodes returns the inodes of the sockets the process has open by
+// looking for 'socket:[<inode>]' links in /proc/<pid>/fd.
+func readSocketInodes(cfg *procConfig, pid uint64) ([]uint64, error) {
+	var inodes []uint64
+
+	dir := fmt.Sprintf("%d/fd", pid)
+	entries, err := readDir(cfg, dir)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for _, entry := range entries {
+		link, err := readLink(cfg, dir+"/"+entry.Name())
+		if err != nil {
+			// fd was closed since we read the directory
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+			continue
+		}
+		inode, err := strconv.ParseUint(link[8:len(link)-1], 10, 64)
+		if err != nil {
+			return nil, withContext(parseError("fd/"+entry.Name(), 0, "", err), pid, "")
+		}
+		inodes = append(inodes, inode)
+	}
+
+	return inodes, nil
+}
+
+func readProcSockets(cfg *procConfig, pid uint64) ([]Socket_t, error) {
+	var result []Socket_t
+
+	inodes, err := readSocketInodes(cfg, pid)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	owned := make(map[uint64]bool)
+	for _, inode := range inodes {
+		owned[inode] = true
+	}
+
+	// use the process' own tables, it may be in another network namespace
+	socks, err := readSockets(cfg, pid)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for _, sock := range socks {
+		if owned[sock.Inode] {
+			sock.Pids = []uint64{pid}
+			result = append(result, sock)
+		}
+	}
+
+	return result, nil
+}
+
+func readSocketOwners(cfg *procConfig) ([]Socket_t, error) {
+	var owners = make(map[uint64][]uint64)
+
+	pids, err := readPids(cfg)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for _, pid := range pids {
+		inodes, err := readSocketInodes(cfg, pid)
+		if err != nil {
+			// like 'ss -p' we just skip processes we can't look at, and
+			// those that exited since we listed them
+			if isUnavailable(err) || isPermission(err) {
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		for _, inode := range inodes {
+			owners[inode] = append(owners[inode], pid)
+		}
+	}
+
+	socks, err := readSockets(cfg, 0)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for i := range socks {
+		socks[i].Pids = owners[socks[i].Inode]
+		sort.Slice(socks[i].Pids, func(a, b int) bool {
+			return socks[i].Pids[a] < socks[i].Pids[b]
+		})
+	}
+
+	return socks, nil
+}
+
+// This function returns the sockets the specified process has open, from
+// /proc/<pid>/fd joined with the /proc/<pid>/net/ socket tables. Pids in each
+// result only contains pid, use SocketOwners() to find all owners.
+func Sockets(pid uint64) ([]Socket_t, error) {
+	return defaultReader.Sockets(pid)
+}
+
+// Sockets is Sockets() for the proc filesystem in r.
+func (r *Reader) Sockets(pid uint64) ([]Socket_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	socks, err := readProcSockets(&cfg, pid)
+	return socks, pidError(&cfg, pid, err)
+}
+
+// This function returns every socket in /proc/net/ (ie. the caller's network
+// namespace) along with the PIDs of all processes that have it open (like
+// 'ss -p'). Processes whose fds can't be read (eg. owned by other users when
+// not root) are skipped, so their sockets will have no Pids.
+func SocketOwners() ([]Socket_t, error) {
+	return defaultReader.SocketOwners()
+}
+
+// SocketOwners is SocketOwners() for the proc filesystem in r.
+func (r *Reader) SocketOwners() ([]Socket_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	return readSocketOwners(&cfg)
+}
@@ -0,0 +1,118 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadSockets(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.contents = map[string]string{
+		"/net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 31337 1 0000000000000000 100 0 0 10 0\n" +
+			"   1: 0100007F:1F90 0100007F:D431 01 00000010:00000020 02:0000041A 00000000  1000        0 31338 4 0000000000000000 20 4 30 10 -1\n",
+		"/net/tcp6": "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000000000000000000001000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 16054 1 0000000000000000 100 0 0 10 0\n",
+		"/net/udp": "   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n" +
+			"  123: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 15433 2 0000000000000000 0\n",
+		"/net/unix": "Num       RefCount Protocol Flags    Type St Inode Path\n" +
+			"0000000000000000: 00000002 00000000 00010000 0001 01 18563 /run/my app.sock\n" +
+			"0000000000000000: 00000003 00000000 00000000 0001 03 18600\n" +
+			"0000000000000000: 00000002 00000000 00000000 0002 01 18601 @/tmp/.X11-unix/X0\n",
+	}
+
+	socks, err := readSockets(&cfg, 0)
+	if err != nil {
+		t.Fatalf("readSockets: %s\n", err.Error())
+	}
+
+	expected := []struct {
+		proto string
+		local string
+		port  uint16
+		state string
+		uid   uint64
+		inode uint64
+		path  string
+	}{
+		{"tcp", "0.0.0.0", 8080, "LISTEN", 1000, 31337, ""},
+		{"tcp", "127.0.0.1", 8080, "ESTABLISHED", 1000, 31338, ""},
+		{"tcp6", "::1", 22, "LISTEN", 0, 16054, ""},
+		{"udp", "127.0.0.53", 53, "UNCONN", 101, 15433, ""},
+		{"unix", "<nil>", 0, "LISTEN", 0, 18563, "/run/my app.sock"},
+		{"unix", "<nil>", 0, "CONNECTED", 0, 18600, ""},
+		{"unix", "<nil>", 0, "UNCONNECTED", 0, 18601, "@/tmp/.X11-unix/X0"},
+	}
+	if len(socks) != len(expected) {
+		t.Fatalf("readSockets: expected %d sockets, got %d\n", len(expected), len(socks))
+	}
+	for i, e := range expected {
+		s := socks[i]
+		if s.Proto != e.proto || s.Local_addr.String() != e.local || s.Local_port != e.port ||
+			s.State != e.state || s.Uid != e.uid || s.Inode != e.inode || s.Path != e.path {
+			t.Errorf("<%d> socket: actual != expected: %#v\n", e.inode, s)
+		} else {
+			fmt.Printf("ok <%d> %s socket matches\n", s.Inode, s.Proto)
+		}
+	}
+	if socks[1].Rem_port != 0xd431 || socks[1].Tx_queue != 0x10 || socks[1].Rx_queue != 0x20 {
+		t.Errorf("<31338> socket: bad remote port or queues: %#v\n", socks[1])
+	}
+}
+
+func TestSockets(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen: %s\n", err.Error())
+	}
+	defer l.Close()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	pid := uint64(os.Getpid())
+
+	socks, err := Sockets(pid)
+	if err != nil {
+		t.Fatalf("Sockets: %s\n", err.Error())
+	}
+	for _, s := range socks {
+		if s.Proto == "tcp" && s.Local_port == port && s.State == "LISTEN" {
+			if len(s.Pids) != 1 || s.Pids[0] != pid {
+				t.Errorf("Sockets: expected Pids [%d], got %v\n", pid, s.Pids)
+			} else {
+				fmt.Printf("ok found our listener on port %d\n", port)
+			}
+			return
+		}
+	}
+	t.Errorf("Sockets: listener on port %d not found\n", port)
+}
+
+func TestSocketsWithoutLinks(t *testing.T) {
+	// only Open(), so the fd links can't be read
+	fsys := struct{ fs.FS }{fstest.MapFS{
+		"1/fd/3":    {Mode: fs.ModeSymlink, Data: []byte("socket:[1234]")},
+		"1/net/tcp": {Data: []byte("  sl  local_address rem_address   st\n")},
+		"2/fd/3":    {Mode: fs.ModeSymlink, Data: []byte("socket:[1234]")},
+		"net/tcp":   {Data: []byte("  sl  local_address rem_address   st\n")},
+	}}
+	r := NewReader(fsys)
+
+	_, err := r.Sockets(1)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Sockets(1): expected ErrUnsupported, got %v\n", err)
+	} else {
+		fmt.Printf("ok Sockets() without ReadLink: %v\n", err)
+	}
+	_, err = r.SocketOwners()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("SocketOwners(): expected ErrUnsupported, got %v\n", err)
+	} else {
+		fmt.Printf("ok SocketOwners() without ReadLink: %v\n", err)
+	}
+}
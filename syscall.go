@@ -0,0 +1,185 @@
+package procreader
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Audit architecture values from include/uapi/linux/audit.h. These are what
+ * seccomp (struct seccomp_data .arch) and the audit subsystem use to identify
+ * which syscall table a number belongs to.
+ */
+const (
+	AUDIT_ARCH_AARCH64 uint32 = 0xc00000b7
+	AUDIT_ARCH_ARM     uint32 = 0x40000028
+	AUDIT_ARCH_I386    uint32 = 0x40000003
+	AUDIT_ARCH_PPC64LE uint32 = 0xc0000015
+	AUDIT_ARCH_RISCV64 uint32 = 0xc00000f3
+	AUDIT_ARCH_S390X   uint32 = 0x80000016
+	AUDIT_ARCH_X86_64  uint32 = 0xc000003e
+)
+
+// tables are generated into zsyscalls.go by mksyscalls.go, the numbers they
+// don't have are in syscall_extra.go
+var syscallTables = map[uint32]map[uint64]string{
+	AUDIT_ARCH_AARCH64: syscalls_arm64,
+	AUDIT_ARCH_ARM:     syscalls_arm,
+	AUDIT_ARCH_I386:    syscalls_i386,
+	AUDIT_ARCH_PPC64LE: syscalls_ppc64le,
+	AUDIT_ARCH_RISCV64: syscalls_riscv64,
+	AUDIT_ARCH_S390X:   syscalls_s390x,
+	AUDIT_ARCH_X86_64:  syscalls_x86_64,
+}
+
+type Syscall_t struct {
+	// fields from /proc/<pid>/syscall
+
+	Running bool      // process is running (not blocked in a syscall), other fields are unset
+	Nr      int64     // syscall number, -1 if blocked but not in a syscall
+	Args    [6]uint64 // syscall arguments (unset when Nr is -1)
+	Sp      uint64    // stack pointer
+	Pc      uint64    // program counter
+}
+
+// This function returns the audit arch for the architecture this program was
+// built for, or 0 if there's no syscall table for it.
+func NativeAuditArch() uint32 {
+	switch runtime.GOARCH {
+	case "amd64":
+		return AUDIT_ARCH_X86_64
+	case "386":
+		return AUDIT_ARCH_I386
+	case "arm64":
+		return AUDIT_ARCH_AARCH64
+	case "arm":
+		return AUDIT_ARCH_ARM
+	case "riscv64":
+		return AUDIT_ARCH_RISCV64
+	case "ppc64le":
+		return AUDIT_ARCH_PPC64LE
+	case "s390x":
+		return AUDIT_ARCH_S390X
+	default:
+		return 0
+	}
+}
+
+// This function returns the name (eg. "read") of syscall number nr for the
+// architecture identified by the audit arch value arch. This includes ARM's
+// private syscalls (eg. 0xf0005 is "set_tls") and x32's (nr with
+// __X32_SYSCALL_BIT set, for AUDIT_ARCH_X86_64). The second return is false if
+// the arch or the number is unknown.
+func SyscallName(arch uint32, nr uint64) (string, bool) {
+	table, ok := syscallTables[arch]
+	if !ok {
+		return "", false
+	}
+
+	switch {
+	case arch == AUDIT_ARCH_ARM && nr > armPrivateSyscallBase:
+		table = syscalls_arm_private
+	case arch == AUDIT_ARCH_X86_64 && nr&x32SyscallBit != 0:
+		nr &^= x32SyscallBit
+		if nr >= x32SyscallBase {
+			table = syscalls_x32
+		}
+	}
+
+	name, ok := table[nr]
+	return name, ok
+}
+
+// This function returns a readable form of the syscall the process is blocked
+// in, eg. "read(0x3, 0x7ffc1a2b3c40, 0x2000, 0x0, 0x0, 0x0)", using the table
+// for arch. Unknown syscalls are shown as "syscall_<nr>(...)".
+func (s *Syscall_t) Describe(arch uint32) string {
+	if s.Running {
+		return "running"
+	}
+	if s.Nr < 0 {
+		return "not in a syscall"
+	}
+
+	name, ok := SyscallName(arch, uint64(s.Nr))
+	if !ok {
+		name = fmt.Sprintf("syscall_%d", s.Nr)
+	}
+
+	args := make([]string, len(s.Args))
+	for i := range s.Args {
+		args[i] = fmt.Sprintf("%#x", s.Args[i])
+	}
+
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+func readSyscall(cfg *procConfig, pid uint64) (Syscall_t, error) {
+	var sc Syscall_t
+
+	lines, err := readLines(cfg, pid, "syscall")
+	if err != nil {
+		return sc, wrapError(err)
+	}
+	if len(lines) != 1 {
+		return sc, parseError("syscall", 0, "", fmt.Errorf("expected 1 line, got %d", len(lines)))
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) == 1 && fields[0] == "running" {
+		sc.Running = true
+		return sc, nil
+	}
+
+	// either '<nr> <args x6> <sp> <pc>' or '-1 <sp> <pc>'
+	if len(fields) != 9 && len(fields) != 3 {
+		return sc, parseError("syscall", 1, "", fmt.Errorf("unexpected format: '%s'", lines[0]))
+	}
+
+	sc.Nr, err = strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sc, parseError("syscall", 1, "Nr", err)
+	}
+	if (sc.Nr < 0) != (len(fields) == 3) {
+		return sc, parseError("syscall", 1, "", fmt.Errorf("unexpected format: '%s'", lines[0]))
+	}
+
+	values := make([]uint64, len(fields)-1)
+	for i := range values {
+		values[i], err = strconv.ParseUint(fields[i+1], 0, 64)
+		if err != nil {
+			field := "Args"
+			switch i {
+			case len(values) - 2:
+				field = "Sp"
+			case len(values) - 1:
+				field = "Pc"
+			}
+			return sc, parseError("syscall", 1, field, err)
+		}
+	}
+
+	copy(sc.Args[:], values[:len(values)-2])
+	sc.Sp = values[len(values)-2]
+	sc.Pc = values[len(values)-1]
+
+	return sc, nil
+}
+
+// This function reads /proc/<pid>/syscall which describes the syscall the
+// process is currently blocked in. Reading this file requires ptrace access to
+// the process, which is why it is not part of ReadProc().
+func ReadSyscall(pid uint64) (Syscall_t, error) {
+	return defaultReader.ReadSyscall(pid)
+}
+
+// ReadSyscall is ReadSyscall() for the proc filesystem in r.
+func (r *Reader) ReadSyscall(pid uint64) (Syscall_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	sc, err := readSyscall(&cfg, pid)
+	return sc, pidError(&cfg, pid, err)
+}
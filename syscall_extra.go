@@ -0,0 +1,69 @@
+package procreader
+
+// This file is maintained by hand, unlike zsyscalls.go: mksyscalls.go only
+// reads the __NR_* syscalls from the unistd.h headers, so the two other ranges
+// of numbers the kernel takes are here:
+//
+//   - ARM's private syscalls, __ARM_NR_* in arch/arm/include/uapi/asm/unistd.h,
+//     from __ARM_NR_BASE. These are the same for 32-bit processes on arm64.
+//   - x32's, which are x86_64 processes (AUDIT_ARCH_X86_64) with
+//     __X32_SYSCALL_BIT set in the number. Below 512 they share x86_64's
+//     numbers; from 512 are the x32 versions of syscalls with pointers in
+//     their arguments, from arch/x86/entry/syscalls/syscall_64.tbl.
+//
+// Neither range has changed in years, but check those files when updating
+// zsyscalls.go.
+
+const (
+	armPrivateSyscallBase uint64 = 0xf0000
+	x32SyscallBit         uint64 = 0x40000000
+	x32SyscallBase        uint64 = 512
+)
+
+var syscalls_arm_private = map[uint64]string{
+	0xf0001: "breakpoint",
+	0xf0002: "cacheflush",
+	0xf0003: "usr26",
+	0xf0004: "usr32",
+	0xf0005: "set_tls",
+	0xf0006: "get_tls",
+}
+
+var syscalls_x32 = map[uint64]string{
+	512: "rt_sigaction",
+	513: "rt_sigreturn",
+	514: "ioctl",
+	515: "readv",
+	516: "writev",
+	517: "recvfrom",
+	518: "sendmsg",
+	519: "recvmsg",
+	520: "execve",
+	521: "ptrace",
+	522: "rt_sigpending",
+	523: "rt_sigtimedwait",
+	524: "rt_sigqueueinfo",
+	525: "sigaltstack",
+	526: "timer_create",
+	527: "mq_notify",
+	528: "kexec_load",
+	529: "waitid",
+	530: "set_robust_list",
+	531: "get_robust_list",
+	532: "vmsplice",
+	533: "move_pages",
+	534: "preadv",
+	535: "pwritev",
+	536: "rt_tgsigqueueinfo",
+	537: "recvmmsg",
+	538: "sendmmsg",
+	539: "process_vm_readv",
+	540: "process_vm_writev",
+	541: "setsockopt",
+	542: "getsockopt",
+	543: "io_setup",
+	544: "io_submit",
+	545: "execveat",
+	546: "preadv2",
+	547: "pwritev2",
+}
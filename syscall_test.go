@@ -0,0 +1,90 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSyscallName(t *testing.T) {
+	tests := []struct {
+		arch uint32
+		nr   uint64
+		name string
+	}{
+		{AUDIT_ARCH_X86_64, 0, "read"},
+		{AUDIT_ARCH_X86_64, 202, "futex"},
+		{AUDIT_ARCH_I386, 3, "read"},
+		{AUDIT_ARCH_AARCH64, 63, "read"},
+		{AUDIT_ARCH_AARCH64, 98, "futex"},
+		{AUDIT_ARCH_ARM, 3, "read"},
+		{AUDIT_ARCH_RISCV64, 259, "riscv_flush_icache"},
+		{AUDIT_ARCH_PPC64LE, 3, "read"},
+		{AUDIT_ARCH_S390X, 3, "read"},
+		{AUDIT_ARCH_S390X, 434, "pidfd_open"},
+		{AUDIT_ARCH_ARM, 0xf0002, "cacheflush"},
+		{AUDIT_ARCH_ARM, 0xf0005, "set_tls"},
+		{AUDIT_ARCH_X86_64, 0x40000000, "read"},
+		{AUDIT_ARCH_X86_64, 0x40000000 + 202, "futex"},
+		{AUDIT_ARCH_X86_64, 0x40000000 + 514, "ioctl"},
+		{AUDIT_ARCH_X86_64, 0x40000000 + 547, "pwritev2"},
+	}
+
+	for _, tt := range tests {
+		name, ok := SyscallName(tt.arch, tt.nr)
+		if !ok || name != tt.name {
+			t.Errorf("SyscallName(%#x, %d): expected '%s', got '%s'\n",
+				tt.arch, tt.nr, tt.name, name)
+		} else {
+			fmt.Printf("ok <%#x> %d == %s\n", tt.arch, tt.nr, name)
+		}
+	}
+
+	if _, ok := SyscallName(0, 0); ok {
+		t.Errorf("SyscallName(0, 0): expected unknown arch to fail\n")
+	}
+	// x32's numbers from 512 aren't x86_64's, and x86_64 has no private ones
+	for _, nr := range []uint64{514, 0xf0005} {
+		if name, ok := SyscallName(AUDIT_ARCH_X86_64, nr); ok {
+			t.Errorf("SyscallName(x86_64, %#x): expected unknown, got '%s'\n", nr, name)
+		}
+	}
+}
+
+func TestReadSyscall(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/proc")
+
+	tests := map[string]Syscall_t{
+		"running\n":                          {Running: true},
+		"-1 0x7ffd5c9e0a18 0x7f0e1b2c3d4e\n": {Nr: -1, Sp: 0x7ffd5c9e0a18, Pc: 0x7f0e1b2c3d4e},
+		"0 0x3 0x7ffd5c9e0b00 0x2000 0x0 0x0 0x0 0x7ffd5c9e0a18 0x7f0e1b2c3d4e\n": {
+			Nr:   0,
+			Args: [6]uint64{0x3, 0x7ffd5c9e0b00, 0x2000, 0, 0, 0},
+			Sp:   0x7ffd5c9e0a18,
+			Pc:   0x7f0e1b2c3d4e,
+		},
+	}
+
+	for content, expected := range tests {
+		cfg.contents = map[string]string{"syscall": content}
+
+		actual, err := readSyscall(&cfg, 1)
+		if err != nil {
+			t.Errorf("readSyscall: %s\n", err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("readSyscall(%q): actual != expected\n", content)
+		} else {
+			fmt.Printf("ok syscall '%s' matches\n", actual.Describe(AUDIT_ARCH_X86_64))
+		}
+	}
+
+	cfg.contents = map[string]string{"syscall": "0 0x3\n"}
+	if _, err := readSyscall(&cfg, 1); !errors.Is(err, ErrParse) {
+		t.Errorf("readSyscall: expected truncated line to be ErrParse, got %v\n", err)
+	}
+}
@@ -0,0 +1,247 @@
+package procreader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PF_KTHREAD from include/linux/sched.h, set in Stat_t.Flags for kernel threads
+const PF_KTHREAD uint64 = 0x00200000
+
+type ProcNode struct {
+	Proc     *Proc
+	Parent   *ProcNode   // nil for roots
+	Children []*ProcNode // sorted by PID
+	Orphan   bool        // parent isn't in the tree (eg. exited, or PID was reused)
+}
+
+type ProcTree struct {
+	Roots []*ProcNode          // init, kthreadd and orphans, sorted by PID
+	Nodes map[uint64]*ProcNode // all nodes, by PID
+}
+
+// SubtreeTotals holds the sums for a process and all of its descendants.
+type SubtreeTotals struct {
+	Procs   uint64 // number of processes
+	Threads uint64 // number of threads (sum of Stat_t.Num_threads)
+	Utime   uint64 // user mode jiffies
+	Stime   uint64 // kernel mode jiffies
+	Rss     uint64 // resident set size (pages)
+}
+
+func readTaskChildren(cfg *procConfig, pid uint64, tid uint64) ([]uint64, error) {
+	var children []uint64
+
+	lines, err := readLines(cfg, pid, fmt.Sprintf("task/%d/children", tid))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for n, line := range lines {
+		for _, field := range strings.Fields(line) {
+			child, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, parseError(fmt.Sprintf("task/%d/children", tid), n+1, "", err)
+			}
+			children = append(children, child)
+		}
+	}
+
+	return children, nil
+}
+
+// readChildren returns the children of all threads of the process. Children
+// are attached to the thread that created them, so for multi-threaded
+// processes /proc/<pid>/task/<pid>/children alone isn't enough.
+func readChildren(cfg *procConfig, pid uint64) ([]uint64, error) {
+	var children []uint64
+	var missing error
+
+	entries, err := readDir(cfg, fmt.Sprintf("%d/task", pid))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for _, entry := range entries {
+		tid, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		taskChildren, err := readTaskChildren(cfg, pid, tid)
+		if err != nil {
+			// thread exited since we read the directory
+			if isUnavailable(err) {
+				missing = err
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		children = append(children, taskChildren...)
+	}
+	// or the whole process did
+	if missing != nil && processGone(cfg, pid, missing) {
+		return nil, wrapError(missing)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i] < children[j]
+	})
+
+	return children, nil
+}
+
+// This function returns the PIDs of the children of the specified process from
+// /proc/<pid>/task/<tid>/children. This requires a kernel built with
+// CONFIG_PROC_CHILDREN.
+func ReadChildren(pid uint64) ([]uint64, error) {
+	return defaultReader.ReadChildren(pid)
+}
+
+// ReadChildren is ReadChildren() for the proc filesystem in r.
+func (r *Reader) ReadChildren(pid uint64) ([]uint64, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	children, err := readChildren(&cfg, pid)
+	return children, pidError(&cfg, pid, err)
+}
+
+// This function links the processes in procs into a forest using Stat_t.Ppid.
+// Processes with Ppid 0 (init and kthreadd) are roots, as are processes whose
+// parent isn't in procs or whose "parent" started after them (meaning the
+// parent exited and its PID was reused); these are marked Orphan. Processes
+// reparented to init or a subreaper are placed under their new parent, as
+// that's what the kernel reports. Should the Ppids form a cycle, its lowest PID
+// is made an orphan root too. The returned nodes point into procs.
+func BuildTree(procs []Proc) *ProcTree {
+	var tree ProcTree
+
+	tree.Nodes = make(map[uint64]*ProcNode, len(procs))
+	for i := range procs {
+		tree.Nodes[procs[i].Stat.Pid] = &ProcNode{Proc: &procs[i]}
+	}
+
+	for _, node := range tree.Nodes {
+		stat := &node.Proc.Stat
+
+		if stat.Ppid <= 0 || uint64(stat.Ppid) == stat.Pid {
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+
+		parent, ok := tree.Nodes[uint64(stat.Ppid)]
+		if !ok || parent.Proc.Stat.Start_time > stat.Start_time {
+			node.Orphan = true
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+	}
+	breakCycles(&tree)
+
+	sortNodes(tree.Roots)
+	for _, node := range tree.Nodes {
+		sortNodes(node.Children)
+	}
+
+	return &tree
+}
+
+// breakCycles makes the lowest PID of each Ppid cycle in the tree an orphan
+// root. A cycle takes processes started in the same tick being each other's
+// parents, which only a list read while PIDs were being reused can have, but
+// walking one (eg. Descendants()) would never end.
+func breakCycles(tree *ProcTree) {
+	done := make(map[*ProcNode]bool, len(tree.Nodes))
+
+	for _, node := range tree.Nodes {
+		path := make(map[*ProcNode]bool)
+
+		n := node
+		for n != nil && !done[n] && !path[n] {
+			path[n] = true
+			n = n.Parent
+		}
+		if n != nil && path[n] {
+			lowest := n
+			for p := n.Parent; p != n; p = p.Parent {
+				if p.Proc.Stat.Pid < lowest.Proc.Stat.Pid {
+					lowest = p
+				}
+			}
+
+			siblings := lowest.Parent.Children
+			for i := range siblings {
+				if siblings[i] == lowest {
+					lowest.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+					break
+				}
+			}
+			lowest.Parent = nil
+			lowest.Orphan = true
+			tree.Roots = append(tree.Roots, lowest)
+		}
+		for p := range path {
+			done[p] = true
+		}
+	}
+}
+
+func sortNodes(nodes []*ProcNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Proc.Stat.Pid < nodes[j].Proc.Stat.Pid
+	})
+}
+
+// Find returns the node for pid, or nil if it's not in the tree.
+func (t *ProcTree) Find(pid uint64) *ProcNode {
+	return t.Nodes[pid]
+}
+
+// IsKernelThread returns true if the process is a kernel thread.
+func (n *ProcNode) IsKernelThread() bool {
+	return n.Proc.Stat.Flags&PF_KTHREAD != 0
+}
+
+// Ancestors returns the parent, grandparent, ... of the node up to its root.
+func (n *ProcNode) Ancestors() []*ProcNode {
+	var ancestors []*ProcNode
+
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+	}
+
+	return ancestors
+}
+
+// Descendants returns all children, grandchildren, ... of the node in
+// depth-first order (each process comes before its children), which is the
+// order to SIGSTOP a job in before killing it.
+func (n *ProcNode) Descendants() []*ProcNode {
+	var descendants []*ProcNode
+
+	for _, child := range n.Children {
+		descendants = append(descendants, child)
+		descendants = append(descendants, child.Descendants()...)
+	}
+
+	return descendants
+}
+
+// Aggregate returns the totals for the node and all of its descendants.
+func (n *ProcNode) Aggregate() SubtreeTotals {
+	var totals SubtreeTotals
+
+	for _, node := range append([]*ProcNode{n}, n.Descendants()...) {
+		totals.Procs++
+		totals.Threads += uint64(node.Proc.Stat.Num_threads)
+		totals.Utime += node.Proc.Stat.Utime
+		totals.Stime += node.Proc.Stat.Stime
+		totals.Rss += node.Proc.Stat.Rss
+	}
+
+	return totals
+}
@@ -0,0 +1,138 @@
+package procreader
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func treeProc(pid uint64, ppid int64, start uint64, flags uint64) Proc {
+	var proc Proc
+
+	proc.Stat = Stat_t{Pid: pid, Ppid: ppid, Start_time: start, Flags: flags,
+		Num_threads: 1, Utime: 10, Stime: 5, Rss: 100}
+
+	return proc
+}
+
+func nodePids(nodes []*ProcNode) []uint64 {
+	var pids []uint64
+
+	for _, node := range nodes {
+		pids = append(pids, node.Proc.Stat.Pid)
+	}
+
+	return pids
+}
+
+func TestBuildTree(t *testing.T) {
+	procs := []Proc{
+		treeProc(1, 0, 1, 0),
+		treeProc(2, 0, 1, PF_KTHREAD),
+		treeProc(10, 2, 2, PF_KTHREAD),
+		treeProc(100, 1, 50, 0),
+		treeProc(200, 100, 60, 0),
+		treeProc(201, 100, 61, 0),
+		treeProc(300, 200, 70, 0),
+		// reparented to init after its parent exited
+		treeProc(400, 1, 80, 0),
+		// parent isn't in the list
+		treeProc(500, 499, 90, 0),
+		// 201 started after its "child", so 201 is a reused PID
+		treeProc(600, 201, 55, 0),
+	}
+
+	tree := BuildTree(procs)
+
+	tests := map[string][2][]uint64{
+		"roots":          {nodePids(tree.Roots), {1, 2, 500, 600}},
+		"init children":  {nodePids(tree.Find(1).Children), {100, 400}},
+		"kthreadd":       {nodePids(tree.Find(2).Children), {10}},
+		"ancestors 300":  {nodePids(tree.Find(300).Ancestors()), {200, 100, 1}},
+		"descendants 1":  {nodePids(tree.Find(1).Descendants()), {100, 200, 300, 201, 400}},
+		"descendants 10": {nodePids(tree.Find(10).Descendants()), nil},
+	}
+	for name, tt := range tests {
+		if !reflect.DeepEqual(tt[0], tt[1]) {
+			t.Errorf("BuildTree %s: expected %v, got %v\n", name, tt[1], tt[0])
+		} else {
+			fmt.Printf("ok tree %s == %v\n", name, tt[0])
+		}
+	}
+
+	if !tree.Find(500).Orphan || !tree.Find(600).Orphan || tree.Find(1).Orphan {
+		t.Errorf("BuildTree: orphans not marked\n")
+	}
+	if !tree.Find(10).IsKernelThread() || tree.Find(100).IsKernelThread() {
+		t.Errorf("BuildTree: kernel threads not identified\n")
+	}
+
+	totals := tree.Find(100).Aggregate()
+	expected := SubtreeTotals{Procs: 4, Threads: 4, Utime: 40, Stime: 20, Rss: 400}
+	if totals != expected {
+		t.Errorf("Aggregate: expected %#v, got %#v\n", expected, totals)
+	} else {
+		fmt.Printf("ok subtree totals match\n")
+	}
+}
+
+func TestBuildTreeCycle(t *testing.T) {
+	// 20 and 21 started in the same tick and are each other's "parent"
+	procs := []Proc{
+		treeProc(1, 0, 1, 0),
+		treeProc(21, 20, 50, 0),
+		treeProc(20, 21, 50, 0),
+		treeProc(22, 21, 60, 0),
+	}
+
+	tree := BuildTree(procs)
+
+	tests := map[string][2][]uint64{
+		"roots":          {nodePids(tree.Roots), {1, 20}},
+		"descendants 20": {nodePids(tree.Find(20).Descendants()), {21, 22}},
+		"ancestors 22":   {nodePids(tree.Find(22).Ancestors()), {21, 20}},
+	}
+	for name, tt := range tests {
+		if !reflect.DeepEqual(tt[0], tt[1]) {
+			t.Errorf("BuildTree %s: expected %v, got %v\n", name, tt[1], tt[0])
+		} else {
+			fmt.Printf("ok cycle %s == %v\n", name, tt[0])
+		}
+	}
+
+	if !tree.Find(20).Orphan || tree.Find(21).Orphan {
+		t.Errorf("BuildTree: expected 20 to be the orphan\n")
+	}
+	if totals := tree.Find(20).Aggregate(); totals.Procs != 3 {
+		t.Errorf("Aggregate: expected 3 procs, got %#v\n", totals)
+	} else {
+		fmt.Printf("ok cycle subtree totals match\n")
+	}
+}
+
+func TestReadChildren(t *testing.T) {
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d/task/%d/children", os.Getpid(), os.Getpid())); err != nil {
+		t.Skipf("kernel doesn't have CONFIG_PROC_CHILDREN\n")
+	}
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("unable to start child: %s\n", err.Error())
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	children, err := ReadChildren(uint64(os.Getpid()))
+	if err != nil {
+		t.Fatalf("ReadChildren: %s\n", err.Error())
+	}
+	for _, child := range children {
+		if child == uint64(cmd.Process.Pid) {
+			fmt.Printf("ok found child %d\n", child)
+			return
+		}
+	}
+	t.Errorf("ReadChildren: %d not in %v\n", cmd.Process.Pid, children)
+}
@@ -0,0 +1,289 @@
+package procreader
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+/*
+ * Based on procps' proc/devname.c, see:
+ * https://gitorious.org/procps/procps/source/3a66fba1e934cbd830df572d8d03c05b4f4a5f1e:proc/devname.c
+ */
+
+type ttyDriver struct {
+	// fields from a line of /proc/tty/drivers
+
+	name      string // driver name, eg. "pty_slave"
+	node      string // default node, eg. "/dev/pts"
+	major     uint32
+	minor_min uint32
+	minor_max uint32
+	tty_type  string // eg. "pty:slave" or "serial"
+}
+
+// ttyDriverCache keeps a Reader's /proc/tty/drivers, which is read for every
+// ps row otherwise. Like the boot time and clock ticks it's only read once,
+// though only a successful read is kept so a failed one is retried.
+type ttyDriverCache struct {
+	mu      sync.Mutex
+	drivers []ttyDriver
+	read    bool
+}
+
+// decodeDev returns the major and minor numbers from a device number encoded
+// the way the kernel's new_encode_dev() does it (as used for Stat_t.Tty_nr),
+// with the low 8 bits of the minor below the major and the rest above.
+func decodeDev(dev uint32) (uint32, uint32) {
+	major := (dev >> 8) & 0xfff
+	minor := (dev & 0xff) | ((dev >> 12) & 0xfff00)
+
+	return major, minor
+}
+
+// decodeRdev splits st_rdev from stat(2), which is in glibc's 64-bit format.
+func decodeRdev(rdev uint64) (uint32, uint32) {
+	major := uint32(((rdev >> 8) & 0xfff) | ((rdev >> 32) &^ 0xfff))
+	minor := uint32((rdev & 0xff) | ((rdev >> 12) &^ 0xff))
+
+	return major, minor
+}
+
+// This function returns the major and minor numbers of the controlling
+// terminal of the process (0, 0 if it has none).
+func TtyDevice(proc *Proc) (uint32, uint32) {
+	return decodeDev(uint32(proc.Stat.Tty_nr))
+}
+
+func readTtyDrivers(cfg *procConfig) ([]ttyDriver, error) {
+	var drivers []ttyDriver
+
+	lines, err := readSystemLines(cfg, "tty/drivers")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for i, line := range lines {
+		var drv ttyDriver
+
+		// the name can contain spaces, but the rest can't
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return nil, parseError("tty/drivers", i+1, "", fmt.Errorf("unexpected format: '%s'", line))
+		}
+		n := len(fields)
+
+		major, err := strconv.ParseUint(fields[n-3], 10, 32)
+		if err != nil {
+			return nil, parseError("tty/drivers", i+1, "major", err)
+		}
+		minors := strings.SplitN(fields[n-2], "-", 2)
+		min, err := strconv.ParseUint(minors[0], 10, 32)
+		if err != nil {
+			return nil, parseError("tty/drivers", i+1, "minor", err)
+		}
+		max := min
+		if len(minors) == 2 {
+			max, err = strconv.ParseUint(minors[1], 10, 32)
+			if err != nil {
+				return nil, parseError("tty/drivers", i+1, "minor", err)
+			}
+		}
+
+		drv.name = strings.Join(fields[:n-4], " ")
+		drv.node = fields[n-4]
+		drv.major = uint32(major)
+		drv.minor_min = uint32(min)
+		drv.minor_max = uint32(max)
+		drv.tty_type = fields[n-1]
+
+		drivers = append(drivers, drv)
+	}
+
+	return drivers, nil
+}
+
+// cachedTtyDrivers is readTtyDrivers() through cfg.ttyDrivers, if it has one.
+func cachedTtyDrivers(cfg *procConfig) ([]ttyDriver, error) {
+	cache := cfg.ttyDrivers
+	if cache == nil {
+		return readTtyDrivers(cfg)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if !cache.read {
+		drivers, err := readTtyDrivers(cfg)
+		if err != nil {
+			return nil, err
+		}
+		cache.drivers = drivers
+		cache.read = true
+	}
+
+	return cache.drivers, nil
+}
+
+// isDevice returns true if name in fsys is a character device with the
+// specified major and minor numbers.
+func isDevice(fsys fs.FS, name string, major uint32, minor uint32) bool {
+	if fsys == nil || !fs.ValidPath(name) {
+		return false
+	}
+	info, err := fs.Stat(fsys, name)
+	if err != nil || info.Mode()&fs.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	maj, min := decodeRdev(uint64(st.Rdev))
+
+	return maj == major && min == minor
+}
+
+// isDevNode returns the name of node (from /proc/tty/drivers or an fd link)
+// relative to /dev, and whether it's the device in cfg.devfs. Nodes outside
+// /dev never are.
+func isDevNode(cfg *procConfig, node string, major uint32, minor uint32) (string, bool) {
+	name, ok := strings.CutPrefix(node, "/dev/")
+	if !ok {
+		return "", false
+	}
+	return name, isDevice(cfg.devfs, name, major, minor)
+}
+
+// driverTtyName looks for the device using the node names from
+// /proc/tty/drivers, eg. "/dev/pts" gives /dev/pts/<minor>.
+func driverTtyName(cfg *procConfig, major uint32, minor uint32) (string, error) {
+	drivers, err := cachedTtyDrivers(cfg)
+	if err != nil {
+		// eg. not mounted, or a fake /proc
+		if isUnavailable(err) || isPermission(err) {
+			return "", nil
+		}
+		return "", wrapError(err)
+	}
+
+	for _, drv := range drivers {
+		if drv.major != major || minor < drv.minor_min || minor > drv.minor_max {
+			continue
+		}
+		candidates := []string{
+			fmt.Sprintf("%s%d", drv.node, minor),
+			fmt.Sprintf("%s/%d", drv.node, minor),
+			fmt.Sprintf("%s%d", drv.node, minor-drv.minor_min),
+			drv.node,
+		}
+		for _, node := range candidates {
+			if name, ok := isDevNode(cfg, node, major, minor); ok {
+				return name, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// linkTtyName checks whether one of the process' stdin, stdout or stderr is
+// the terminal, in which case the link gives the name.
+func linkTtyName(cfg *procConfig, pid uint64, major uint32, minor uint32) string {
+	for _, fd := range []int{2, 0, 1, 255} {
+		link, err := readLink(cfg, fmt.Sprintf("%d/fd/%d", pid, fd))
+		if err != nil {
+			continue
+		}
+		if name, ok := isDevNode(cfg, link, major, minor); ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// scanTtyName looks through /dev/pts and then /dev for the device.
+func scanTtyName(cfg *procConfig, major uint32, minor uint32) string {
+	if cfg.devfs == nil {
+		return ""
+	}
+	for _, dir := range []string{"pts", "."} {
+		entries, err := fs.ReadDir(cfg.devfs, dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			if isDevice(cfg.devfs, name, major, minor) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// guessTtyName uses the fixed device numbers from the kernel's
+// Documentation/admin-guide/devices.txt, for when there's no /dev to look at.
+func guessTtyName(major uint32, minor uint32) string {
+	switch {
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("ttyS%d", minor-64)
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("pts/%d", minor+(major-136)*256)
+	case major == 5 && minor == 1:
+		return "console"
+	}
+
+	return ""
+}
+
+func readTtyName(cfg *procConfig, proc *Proc) (string, error) {
+	if proc.Stat.Tty_nr == 0 {
+		return "?", nil
+	}
+	major, minor := TtyDevice(proc)
+
+	name, err := driverTtyName(cfg, major, minor)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if name == "" {
+		name = linkTtyName(cfg, proc.Stat.Pid, major, minor)
+	}
+	if name == "" {
+		name = scanTtyName(cfg, major, minor)
+	}
+	if name == "" {
+		name = guessTtyName(major, minor)
+	}
+	if name == "" {
+		return "?", nil
+	}
+
+	return name, nil
+}
+
+// This function returns the name of the controlling terminal of the process
+// relative to /dev (eg. "pts/0" or "tty1") like ps(1) shows it, or "?" if it
+// has none. Like procps it tries the names from /proc/tty/drivers, then the
+// process' fd 0-2 links, then the devices in /dev/pts and /dev, and finally
+// the well known device numbers.
+func TtyName(proc *Proc) (string, error) {
+	return defaultReader.TtyName(proc)
+}
+
+// TtyName is TtyName() for the proc filesystem in r.
+func (r *Reader) TtyName(proc *Proc) (string, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	return readTtyName(&cfg, proc)
+}
@@ -0,0 +1,268 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// encodeDev is the kernel's new_encode_dev()
+func encodeDev(major uint32, minor uint32) int64 {
+	return int64((minor & 0xff) | (major << 8) | ((minor &^ 0xff) << 12))
+}
+
+func ttyProc(pid uint64, major uint32, minor uint32) *Proc {
+	var proc Proc
+
+	proc.Stat.Pid = pid
+	proc.Stat.Tty_nr = encodeDev(major, minor)
+
+	return &proc
+}
+
+func requireDevice(t *testing.T, name string, major uint32, minor uint32) {
+	if !isDevice(dirFS("/dev"), name, major, minor) {
+		t.Skipf("/dev/%s isn't %d:%d\n", name, major, minor)
+	}
+}
+
+// ttyDevice is a character device for a fstest.MapFS /dev, with st_rdev in
+// glibc's encoding like stat(2) gives it.
+func ttyDevice(major uint32, minor uint32) *fstest.MapFile {
+	rdev := uint64(minor&0xff) | uint64(major&0xfff)<<8 | uint64(minor&^0xff)<<12
+
+	return &fstest.MapFile{
+		Mode: fs.ModeDevice | fs.ModeCharDevice | 0620,
+		Sys:  &syscall.Stat_t{Rdev: rdev},
+	}
+}
+
+func TestTtyDevice(t *testing.T) {
+	var tests = []struct {
+		major uint32
+		minor uint32
+	}{
+		{0, 0},
+		{4, 1},
+		{136, 3},
+		{136, 300},     // minor > 255 uses the split encoding
+		{136, 1048575}, // largest pty minor
+	}
+
+	for _, test := range tests {
+		major, minor := TtyDevice(ttyProc(1, test.major, test.minor))
+		if major != test.major || minor != test.minor {
+			t.Errorf("TtyDevice(%d:%d): got %d:%d\n", test.major, test.minor, major, minor)
+			continue
+		}
+		fmt.Printf("ok TtyDevice(%d:%d)\n", test.major, test.minor)
+	}
+}
+
+func TestTtyNameGuess(t *testing.T) {
+	var cfg procConfig
+
+	// nothing to look at, so only the well known numbers work
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.devfs = dirFS("/nonexistent/dev")
+	cfg.contents = make(map[string]string)
+
+	var tests = []struct {
+		major  uint32
+		minor  uint32
+		expect string
+	}{
+		{0, 0, "?"},
+		{4, 2, "tty2"},
+		{4, 65, "ttyS1"},
+		{136, 3, "pts/3"},
+		{136, 300, "pts/300"},
+		{5, 1, "console"},
+		{200, 1, "?"},
+	}
+
+	for _, test := range tests {
+		name, err := readTtyName(&cfg, ttyProc(1, test.major, test.minor))
+		if err != nil {
+			t.Errorf("readTtyName(%d:%d): %v\n", test.major, test.minor, err)
+			continue
+		}
+		if name != test.expect {
+			t.Errorf("readTtyName(%d:%d): expected '%s', got '%s'\n",
+				test.major, test.minor, test.expect, name)
+			continue
+		}
+		fmt.Printf("ok readTtyName(%d:%d) == %s\n", test.major, test.minor, name)
+	}
+}
+
+func TestTtyNameDrivers(t *testing.T) {
+	var cfg procConfig
+
+	requireDevice(t, "console", 5, 1)
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.devfs = dirFS("/dev")
+	cfg.contents = map[string]string{
+		"/tty/drivers": "/dev/tty             /dev/tty        5       0 system:/dev/tty\n" +
+			"/dev/console         /dev/console    5       1 system:console\n" +
+			"pty_slave            /dev/pts      136 0-1048575 pty:slave\n",
+	}
+
+	drivers, err := readTtyDrivers(&cfg)
+	if err != nil {
+		t.Fatalf("readTtyDrivers(): %v\n", err)
+	}
+	if len(drivers) != 3 || drivers[2].node != "/dev/pts" ||
+		drivers[2].minor_min != 0 || drivers[2].minor_max != 1048575 {
+		t.Errorf("readTtyDrivers(): unexpected result %#v\n", drivers)
+	} else {
+		fmt.Printf("ok readTtyDrivers()\n")
+	}
+
+	name, err := readTtyName(&cfg, ttyProc(1, 5, 1))
+	if err != nil || name != "console" {
+		t.Errorf("readTtyName(5:1): expected 'console', got '%s' (%v)\n", name, err)
+		return
+	}
+	fmt.Printf("ok readTtyName(5:1) == %s from drivers\n", name)
+}
+
+func TestTtyNameLinks(t *testing.T) {
+	var cfg procConfig
+
+	// /dev/full stands in for a terminal we can only find through the fds
+	requireDevice(t, "full", 1, 7)
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "proc/42/fd"), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll(): %v\n", err)
+	}
+	err = os.Symlink("/dev/full", filepath.Join(dir, "proc/42/fd/0"))
+	if err != nil {
+		t.Fatalf("Symlink(): %v\n", err)
+	}
+
+	cfg.fsys = dirFS(filepath.Join(dir, "proc"))
+	cfg.devfs = dirFS("/dev")
+	cfg.contents = map[string]string{"/tty/drivers": ""}
+
+	name, err := readTtyName(&cfg, ttyProc(42, 1, 7))
+	if err != nil || name != "full" {
+		t.Errorf("readTtyName(1:7): expected 'full', got '%s' (%v)\n", name, err)
+		return
+	}
+	fmt.Printf("ok readTtyName(1:7) == %s from fd links\n", name)
+}
+
+func TestTtyNameScan(t *testing.T) {
+	var cfg procConfig
+
+	requireDevice(t, "full", 1, 7)
+
+	dir := t.TempDir()
+
+	// a /dev with the device as pts/7 and as a top-level ttyX
+	err := os.MkdirAll(filepath.Join(dir, "dev/pts"), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll(): %v\n", err)
+	}
+	for _, link := range []string{"dev/ttyX", "dev/pts/7"} {
+		err = os.Symlink("/dev/full", filepath.Join(dir, link))
+		if err != nil {
+			t.Fatalf("Symlink(): %v\n", err)
+		}
+	}
+
+	cfg.fsys = dirFS("/nonexistent/path")
+	cfg.devfs = dirFS(filepath.Join(dir, "dev"))
+	cfg.contents = make(map[string]string)
+
+	name, err := readTtyName(&cfg, ttyProc(42, 1, 7))
+	if err != nil || name != "pts/7" {
+		t.Errorf("readTtyName(1:7): expected 'pts/7', got '%s' (%v)\n", name, err)
+		return
+	}
+	fmt.Printf("ok readTtyName(1:7) == %s from /dev/pts\n", name)
+
+	err = os.Remove(filepath.Join(dir, "dev/pts/7"))
+	if err != nil {
+		t.Fatalf("Remove(): %v\n", err)
+	}
+	name, err = readTtyName(&cfg, ttyProc(42, 1, 7))
+	if err != nil || name != "ttyX" {
+		t.Errorf("readTtyName(1:7): expected 'ttyX', got '%s' (%v)\n", name, err)
+		return
+	}
+	fmt.Printf("ok readTtyName(1:7) == %s from /dev\n", name)
+}
+
+func TestTtyNameFS(t *testing.T) {
+	var cfg procConfig
+
+	// a /dev that's only in memory, and drivers that are read once
+	proc := fstest.MapFS{
+		"tty/drivers": {Data: []byte("serial /dev/ttyFOO 250 0-3 serial\n")},
+	}
+	cfg.fsys = proc
+	cfg.devfs = fstest.MapFS{
+		"ttyFOO2": ttyDevice(250, 2),
+		"pts/4":   ttyDevice(136, 4),
+		"ttyFOO3": {Sys: &syscall.Stat_t{Rdev: 250<<8 | 3}},
+	}
+	cfg.ttyDrivers = &ttyDriverCache{}
+
+	ttyName := func(major uint32, minor uint32) (string, error) {
+		cfg.contents = make(map[string]string)
+		return readTtyName(&cfg, ttyProc(1, major, minor))
+	}
+
+	var tests = []struct {
+		major  uint32
+		minor  uint32
+		expect string
+	}{
+		{250, 2, "ttyFOO2"},
+		{136, 4, "pts/4"},
+		{250, 3, "?"}, // a regular file, not a device
+	}
+
+	for _, test := range tests {
+		name, err := ttyName(test.major, test.minor)
+		if err != nil || name != test.expect {
+			t.Errorf("readTtyName(%d:%d): expected '%s', got '%s' (%v)\n",
+				test.major, test.minor, test.expect, name, err)
+			continue
+		}
+		fmt.Printf("ok readTtyName(%d:%d) == %s\n", test.major, test.minor, name)
+	}
+
+	// the drivers were kept, so a broken file doesn't matter now
+	proc["tty/drivers"] = &fstest.MapFile{Data: []byte("broken\n")}
+	name, err := ttyName(250, 2)
+	if err != nil || name != "ttyFOO2" {
+		t.Errorf("readTtyName(250:2): expected cached drivers, got '%s' (%v)\n", name, err)
+	} else {
+		fmt.Printf("ok tty/drivers read once\n")
+	}
+
+	// but a failed read isn't kept
+	cfg.ttyDrivers = &ttyDriverCache{}
+	_, err = ttyName(250, 2)
+	if !errors.Is(err, ErrParse) {
+		t.Errorf("readTtyName(250:2): expected ErrParse, got %v\n", err)
+	}
+	proc["tty/drivers"] = &fstest.MapFile{Data: []byte("serial /dev/ttyFOO 250 0-3 serial\n")}
+	name, err = ttyName(250, 2)
+	if err != nil || name != "ttyFOO2" {
+		t.Errorf("readTtyName(250:2): expected a new read, got '%s' (%v)\n", name, err)
+	} else {
+		fmt.Printf("ok failed tty/drivers read not cached\n")
+	}
+}
@@ -0,0 +1,134 @@
+package procreader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IdMapRange is one line of /proc/<pid>/{uid_map,gid_map}: Length IDs starting
+// at Inside in the process' user namespace map to IDs starting at Outside in
+// the user namespace of the process that read the file (the host, for a
+// monitoring agent).
+type IdMapRange struct {
+	Inside  uint64
+	Outside uint64
+	Length  uint64
+}
+
+type IdMap []IdMapRange
+
+type UserNamespace_t struct {
+	// fields from /proc/<pid>/{uid_map,gid_map,setgroups}
+
+	UidMap    IdMap  // mapping of UIDs in the namespace to UIDs on the host
+	GidMap    IdMap  // mapping of GIDs in the namespace to GIDs on the host
+	Setgroups string // "allow" or "deny" (whether setgroups(2) is permitted)
+}
+
+// MapToHost returns the host ID for id in the process' user namespace, eg. 0
+// (root in a rootless container) might be 100000. The second return is false
+// if id is not mapped (it shows up as the overflow ID, usually 65534).
+func (m IdMap) MapToHost(id uint64) (uint64, bool) {
+	for _, r := range m {
+		if id >= r.Inside && id-r.Inside < r.Length {
+			return r.Outside + (id - r.Inside), true
+		}
+	}
+	return 0, false
+}
+
+// MapFromHost is the reverse of MapToHost, returning the ID in the process'
+// user namespace for the host ID id.
+func (m IdMap) MapFromHost(id uint64) (uint64, bool) {
+	for _, r := range m {
+		if id >= r.Outside && id-r.Outside < r.Length {
+			return r.Inside + (id - r.Outside), true
+		}
+	}
+	return 0, false
+}
+
+// IsIdentity returns true if the map is the "0 0 4294967295" map of the
+// initial user namespace, ie. the process is not in a user namespace.
+func (m IdMap) IsIdentity() bool {
+	return len(m) == 1 && m[0].Inside == 0 && m[0].Outside == 0 &&
+		m[0].Length == 4294967295
+}
+
+// names of the fields of IdMapRange, in the order of uid_map and gid_map
+var idMapFields = [...]string{"Inside", "Outside", "Length"}
+
+func readIdMap(cfg *procConfig, pid uint64, filename string) (IdMap, error) {
+	var idmap IdMap
+
+	lines, err := readLines(cfg, pid, filename)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for n, line := range lines {
+		var r IdMapRange
+		var values [3]uint64
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, parseError(filename, n+1, "",
+				fmt.Errorf("expected 3 fields, got %d: '%s'", len(fields), line))
+		}
+		for i := range fields {
+			values[i], err = strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, parseError(filename, n+1, idMapFields[i], err)
+			}
+		}
+		r.Inside = values[0]
+		r.Outside = values[1]
+		r.Length = values[2]
+
+		idmap = append(idmap, r)
+	}
+
+	return idmap, nil
+}
+
+func readUserNamespace(cfg *procConfig, pid uint64) (UserNamespace_t, error) {
+	var userns UserNamespace_t
+	var err error
+
+	userns.UidMap, err = readIdMap(cfg, pid, "uid_map")
+	if err != nil {
+		return userns, wrapError(err)
+	}
+	userns.GidMap, err = readIdMap(cfg, pid, "gid_map")
+	if err != nil {
+		return userns, wrapError(err)
+	}
+
+	// setgroups only exists since 3.19
+	lines, err := readLines(cfg, pid, "setgroups")
+	if err != nil {
+		if !isUnavailable(err) {
+			return userns, wrapError(err)
+		}
+	} else if len(lines) > 0 {
+		userns.Setgroups = strings.TrimSpace(lines[0])
+	}
+
+	return userns, nil
+}
+
+// This function reads /proc/<pid>/{uid_map,gid_map,setgroups} and returns the
+// user namespace ID mappings for the specified process.
+func ReadUserNamespace(pid uint64) (UserNamespace_t, error) {
+	return defaultReader.ReadUserNamespace(pid)
+}
+
+// ReadUserNamespace is ReadUserNamespace() for the proc filesystem in r.
+func (r *Reader) ReadUserNamespace(pid uint64) (UserNamespace_t, error) {
+	cfg := r.config()
+	cfg.contents = make(map[string]string)
+
+	userns, err := readUserNamespace(&cfg, pid)
+	return userns, pidError(&cfg, pid, err)
+}
@@ -0,0 +1,82 @@
+package procreader
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestReadUserNamespace(t *testing.T) {
+	var cfg procConfig
+
+	cfg.fsys = dirFS("/nonexistent/path")
+
+	// a rootless container
+	cfg.contents = map[string]string{
+		"uid_map":   "         0       1000          1\n         1     100000      65536\n",
+		"gid_map":   "         0       1000          1\n         1     100000      65536\n",
+		"setgroups": "deny\n",
+	}
+
+	userns, err := readUserNamespace(&cfg, 1)
+	if err != nil {
+		t.Fatalf("readUserNamespace: %s\n", err.Error())
+	}
+
+	expected := IdMap{{Inside: 0, Outside: 1000, Length: 1}, {Inside: 1, Outside: 100000, Length: 65536}}
+	if !reflect.DeepEqual(userns.UidMap, expected) || !reflect.DeepEqual(userns.GidMap, expected) {
+		t.Errorf("readUserNamespace: actual != expected: %#v\n", userns)
+	} else if userns.Setgroups != "deny" {
+		t.Errorf("readUserNamespace: expected setgroups 'deny', got '%s'\n", userns.Setgroups)
+	} else {
+		fmt.Printf("ok user namespace matches\n")
+	}
+
+	tests := []struct {
+		inside  uint64
+		outside uint64
+		mapped  bool
+	}{
+		{0, 1000, true},
+		{1, 100000, true},
+		{1000, 100999, true},
+		{65536, 165535, true},
+		{65537, 0, false},
+	}
+	for _, tt := range tests {
+		host, ok := userns.UidMap.MapToHost(tt.inside)
+		if ok != tt.mapped || host != tt.outside {
+			t.Errorf("MapToHost(%d): expected %d/%t, got %d/%t\n",
+				tt.inside, tt.outside, tt.mapped, host, ok)
+			continue
+		}
+		if !ok {
+			fmt.Printf("ok %d is unmapped\n", tt.inside)
+			continue
+		}
+		id, ok := userns.UidMap.MapFromHost(host)
+		if !ok || id != tt.inside {
+			t.Errorf("MapFromHost(%d): expected %d, got %d/%t\n", host, tt.inside, id, ok)
+		} else {
+			fmt.Printf("ok %d in container == %d on host\n", id, host)
+		}
+	}
+
+	if userns.UidMap.IsIdentity() {
+		t.Errorf("IsIdentity: rootless container map is not the identity\n")
+	}
+
+	// the initial namespace, on a kernel without setgroups
+	cfg.contents = map[string]string{
+		"uid_map": "         0          0 4294967295\n",
+		"gid_map": "         0          0 4294967295\n",
+	}
+	userns, err = readUserNamespace(&cfg, 1)
+	if err != nil {
+		t.Errorf("readUserNamespace: %s\n", err.Error())
+	} else if !userns.UidMap.IsIdentity() || userns.Setgroups != "" {
+		t.Errorf("readUserNamespace: expected identity map: %#v\n", userns)
+	} else {
+		fmt.Printf("ok initial user namespace matches\n")
+	}
+}
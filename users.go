@@ -0,0 +1,308 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Resolver maps UIDs and GIDs (eg. from Status_t.Uid, Gid and Groups) to
+// names using the passwd and group files under a root directory. The files
+// are read the first time they're needed and cached until Reload() is called.
+// A Resolver is safe for use from multiple goroutines.
+//
+// Symbolic links at etc/passwd and etc/group are resolved against the root
+// directory rather than the host, so that eg. a container's /etc/passwd ->
+// /usr/lib/passwd is read from the container. Links in the directories above
+// them (eg. /etc itself being a link) are followed by the host's kernel.
+type Resolver struct {
+	mu     sync.Mutex
+	cfg    procConfig
+	root   string // where the files are, for errors
+	pid    uint64 // whose root it is, 0 for NewResolver()
+	err    error  // from setting up, returned by every lookup
+	users  map[uint64]string
+	groups map[uint64]string
+}
+
+// This function returns a Resolver which uses <root>/etc/passwd and
+// <root>/etc/group. Use "/" for the host's users and groups.
+func NewResolver(root string) *Resolver {
+	r := newFSResolver(dirFS(root))
+	r.root = root
+
+	return r
+}
+
+// newFSResolver returns a Resolver which uses etc/passwd and etc/group in
+// fsys.
+func newFSResolver(fsys fs.FS) *Resolver {
+	var r Resolver
+
+	r.cfg.fsys = fsys
+	r.cfg.contents = make(map[string]string)
+	r.root = "."
+
+	return &r
+}
+
+// This function returns a Resolver for the users and groups as seen by the
+// specified process, ie. using /proc/<pid>/root/etc/{passwd,group}. This is
+// what you want for processes in containers.
+func NewProcResolver(pid uint64) *Resolver {
+	return defaultReader.NewProcResolver(pid)
+}
+
+// NewProcResolver returns a Resolver for the users and groups in
+// <pid>/root/etc in r. If that can't be used, the Resolver's lookups all
+// return the error.
+func (r *Reader) NewProcResolver(pid uint64) *Resolver {
+	name := fmt.Sprintf("%d/root", pid)
+
+	root, err := fs.Sub(r.fsys, name)
+	if err != nil {
+		return &Resolver{root: name, pid: pid, err: withContext(err, pid, "root")}
+	}
+
+	resolver := newFSResolver(root)
+	resolver.root = name
+	resolver.pid = pid
+
+	return resolver
+}
+
+// ProcResolvers gives out the Resolvers of NewProcResolver(), sharing one
+// between the processes in each mount namespace so that a container's passwd
+// and group files are only read once. It is safe for use from multiple
+// goroutines.
+type ProcResolvers struct {
+	mu        sync.Mutex
+	reader    *Reader
+	resolvers map[string]*Resolver // by mount namespace, nil if unreadable
+}
+
+// This function returns ProcResolvers for the processes in /proc.
+func NewProcResolvers() *ProcResolvers {
+	return defaultReader.NewProcResolvers()
+}
+
+// NewProcResolvers returns ProcResolvers for the processes in r.
+func (r *Reader) NewProcResolvers() *ProcResolvers {
+	return &ProcResolvers{reader: r, resolvers: make(map[string]*Resolver)}
+}
+
+// Resolver returns the Resolver for proc's users and groups, or nil if its
+// root can't be read (eg. without privileges for another user's process) so
+// that the caller can use the host's instead. When the mount namespace of proc
+// can't be read, it gets a Resolver of its own.
+func (p *ProcResolvers) Resolver(proc *Proc) *Resolver {
+	pid := proc.Stat.Pid
+	cfg := p.reader.config()
+
+	key, err := readLink(&cfg, fmt.Sprintf("%d/ns/mnt", pid))
+	if err != nil {
+		key = fmt.Sprintf("%d/root", pid)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resolver, ok := p.resolvers[key]
+	if !ok {
+		resolver = p.reader.NewProcResolver(pid)
+		_, _, err = resolver.LookupUser(0)
+		if isUnavailable(err) || isPermission(err) {
+			resolver = nil
+		}
+		p.resolvers[key] = resolver
+	}
+
+	return resolver
+}
+
+// the most links followed to get to a passwd or group file, like the kernel's
+// limit for a path
+const maxIdFileLinks = 40
+
+// resolveIdFile returns the name in cfg.fsys of the file at name, following
+// symbolic links within cfg.fsys: absolute ones are from its root and
+// relative ones can't leave it, as they would be from inside a container.
+func resolveIdFile(cfg *procConfig, name string) (string, error) {
+	for i := 0; i < maxIdFileLinks; i++ {
+		target, err := readLink(cfg, name)
+		if err != nil {
+			// not a link (or we can't tell), so it's read as it is
+			return name, nil
+		}
+		if !path.IsAbs(target) {
+			target = path.Join("/", path.Dir(name), target)
+		}
+		name = strings.TrimPrefix(path.Clean(target), "/")
+		if name == "" {
+			name = "."
+		}
+	}
+
+	return "", &fs.PathError{Op: "open", Path: name, Err: syscall.ELOOP}
+}
+
+// readIdFile parses passwd(5) or group(5) format files, both of which have the
+// name in the first field and the ID in the third.
+func readIdFile(cfg *procConfig, filename string) (map[uint64]string, error) {
+	var ids = make(map[uint64]string)
+
+	name, err := resolveIdFile(cfg, filename)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := readContents(cfg, "/"+filename, name)
+	if err != nil {
+		// eg. scratch containers don't have an /etc/passwd
+		if isUnavailable(err) {
+			return ids, nil
+		}
+		return nil, err
+	}
+	lines, err := splitLines(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		// skip comments and NIS '+'/'-' entries
+		if len(line) == 0 || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		// like getpwuid(3), the first entry wins
+		if _, ok := ids[id]; !ok {
+			ids[id] = fields[0]
+		}
+	}
+
+	return ids, nil
+}
+
+func (r *Resolver) load() error {
+	var err error
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.users == nil {
+		r.users, err = readIdFile(&r.cfg, "etc/passwd")
+		if err != nil {
+			return r.fileError(err, "etc/passwd")
+		}
+	}
+	if r.groups == nil {
+		r.groups, err = readIdFile(&r.cfg, "etc/group")
+		if err != nil {
+			return r.fileError(err, "etc/group")
+		}
+	}
+
+	return nil
+}
+
+// fileError adds which root (and so which process) filename was read from to
+// err.
+func (r *Resolver) fileError(err error, filename string) error {
+	var procErr *ProcErr
+
+	if errors.As(err, &procErr) {
+		err = procErr.error
+	}
+	err = fmt.Errorf("%s in %s: %w", filename, r.root, err)
+	if r.pid != 0 {
+		return withContext(err, r.pid, "root/"+filename)
+	}
+	return wrapError(err)
+}
+
+// Reload discards the cached users and groups so they'll be re-read on next use.
+func (r *Resolver) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users = nil
+	r.groups = nil
+	r.cfg.contents = make(map[string]string)
+}
+
+// LookupUser returns the name for uid and whether one was found.
+func (r *Resolver) LookupUser(uid uint64) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.load(); err != nil {
+		return "", false, wrapError(err)
+	}
+	name, ok := r.users[uid]
+	return name, ok, nil
+}
+
+// LookupGroup returns the name for gid and whether one was found.
+func (r *Resolver) LookupGroup(gid uint64) (string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.load(); err != nil {
+		return "", false, wrapError(err)
+	}
+	name, ok := r.groups[gid]
+	return name, ok, nil
+}
+
+// UserName returns the name for uid or, like ps(1), the number as a string if
+// there is no such user.
+func (r *Resolver) UserName(uid uint64) (string, error) {
+	name, ok, err := r.LookupUser(uid)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if !ok {
+		return strconv.FormatUint(uid, 10), nil
+	}
+	return name, nil
+}
+
+// GroupName returns the name for gid or, like ps(1), the number as a string if
+// there is no such group.
+func (r *Resolver) GroupName(gid uint64) (string, error) {
+	name, ok, err := r.LookupGroup(gid)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if !ok {
+		return strconv.FormatUint(gid, 10), nil
+	}
+	return name, nil
+}
+
+// GroupNames returns GroupName() for each of gids (eg. Status_t.Groups).
+func (r *Resolver) GroupNames(gids []uint64) ([]string, error) {
+	var names []string
+
+	for _, gid := range gids {
+		name, err := r.GroupName(gid)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,216 @@
+package procreader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolver(t *testing.T) {
+	r := NewResolver("/nonexistent/path")
+	r.cfg.contents = map[string]string{
+		"/etc/passwd": "# comment\nroot:x:0:0:root:/root:/bin/bash\ntoor:x:0:0:root:/root:/bin/sh\n" +
+			"josh:x:1000:1000:Josh,,,:/home/josh:/bin/bash\n+::::::\n",
+		"/etc/group": "root:x:0:\nadm:x:4:josh\njosh:x:1000:\n",
+	}
+
+	users := map[uint64]string{0: "root", 1000: "josh", 1001: "1001"}
+	for uid, expected := range users {
+		name, err := r.UserName(uid)
+		if err != nil {
+			t.Errorf("UserName(%d): %s\n", uid, err.Error())
+		} else if name != expected {
+			t.Errorf("UserName(%d): expected '%s', got '%s'\n", uid, expected, name)
+		} else {
+			fmt.Printf("ok uid %d == %s\n", uid, name)
+		}
+	}
+
+	names, err := r.GroupNames([]uint64{0, 4, 1000, 27})
+	if err != nil {
+		t.Errorf("GroupNames: %s\n", err.Error())
+	} else if !reflect.DeepEqual(names, []string{"root", "adm", "josh", "27"}) {
+		t.Errorf("GroupNames: actual != expected: %#v\n", names)
+	} else {
+		fmt.Printf("ok groups == %v\n", names)
+	}
+
+	// no passwd or group file (eg. a scratch container) is not an error
+	r = NewResolver("/nonexistent/path")
+	if _, ok, err := r.LookupUser(0); err != nil || ok {
+		t.Errorf("LookupUser(0): expected not found, got %t %v\n", ok, err)
+	} else {
+		fmt.Printf("ok missing passwd\n")
+	}
+}
+
+func TestResolverLinks(t *testing.T) {
+	// as in eg. distroless images, /etc/passwd -> /usr/lib/passwd, which
+	// must be the container's and not the host's
+	root := t.TempDir()
+	for _, dir := range []string{"etc", "usr/lib", "usr/share"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	files := map[string]string{
+		"usr/lib/passwd":  "app:x:1000:1000::/app:/bin/sh\n",
+		"usr/share/group": "app:x:1000:\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%v\n", err)
+		}
+	}
+	links := map[string]string{
+		"etc/passwd": "/usr/lib/passwd",
+		"etc/group":  "../../../../usr/lib/../share/group", // can't leave root
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("unable to create symlinks: %v\n", err)
+		}
+	}
+
+	r := NewResolver(root)
+	user, err := r.UserName(1000)
+	if err != nil || user != "app" {
+		t.Errorf("UserName(1000): expected 'app', got '%s' (%v)\n", user, err)
+	}
+	group, err := r.GroupName(1000)
+	if err != nil || group != "app" {
+		t.Errorf("GroupName(1000): expected 'app', got '%s' (%v)\n", group, err)
+	}
+	if !t.Failed() {
+		fmt.Printf("ok links resolved within root: %s/%s\n", user, group)
+	}
+
+	if err := os.Symlink("passwd", filepath.Join(root, "etc/loop")); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	os.Remove(filepath.Join(root, "etc/passwd"))
+	if err := os.Symlink("loop", filepath.Join(root, "etc/passwd")); err != nil {
+		t.Fatalf("%v\n", err)
+	}
+	r = NewResolver(root)
+	if _, err := r.UserName(1000); err == nil || !strings.Contains(err.Error(), root) {
+		t.Errorf("UserName(1000): expected a loop in %s, got %v\n", root, err)
+	} else {
+		fmt.Printf("ok link loop: %v\n", err)
+	}
+}
+
+// subErrFS is an fs.FS which can't be used for anything, not even fs.Sub().
+type subErrFS struct{}
+
+func (subErrFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func (subErrFS) Sub(name string) (fs.FS, error) {
+	return nil, &fs.PathError{Op: "sub", Path: name, Err: fs.ErrPermission}
+}
+
+func TestProcResolverErrors(t *testing.T) {
+	r := NewReader(subErrFS{}).NewProcResolver(42)
+	if _, err := r.UserName(0); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("UserName(0): expected the error from fs.Sub(), got %v\n", err)
+	} else {
+		fmt.Printf("ok unusable root: %v\n", err)
+	}
+
+	r = NewReader(fstest.MapFS{"7/root/etc/passwd": {Mode: fs.ModeDir}}).NewProcResolver(7)
+	_, err := r.UserName(0)
+	var procErr *ProcErr
+	if !errors.As(err, &procErr) || procErr.Pid != 7 || !strings.Contains(err.Error(), "7/root") {
+		t.Errorf("UserName(0): expected an error for 7/root, got %v\n", err)
+	} else {
+		fmt.Printf("ok bad passwd: %v\n", err)
+	}
+}
+
+// denyFS is a proc filesystem in which the files under deny can't be read.
+type denyFS struct {
+	fsys fstest.MapFS
+	deny string
+}
+
+func (d denyFS) Open(name string) (fs.File, error) {
+	if strings.HasPrefix(name, d.deny) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return d.fsys.Open(name)
+}
+
+func (d denyFS) ReadLink(name string) (string, error) {
+	file, ok := d.fsys[name]
+	if !ok || file.Mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return string(file.Data), nil
+}
+
+func TestProcResolvers(t *testing.T) {
+	mnt := func(ns string) *fstest.MapFile {
+		return &fstest.MapFile{Mode: fs.ModeSymlink, Data: []byte(ns)}
+	}
+	passwd := func(name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(name + ":x:1000:1000::/:/bin/sh\n")}
+	}
+	fsys := fstest.MapFS{
+		// 1 and 2 are in a container, 3 is another user's on the host and
+		// 4's namespace can't be read
+		"1/ns/mnt":          mnt("mnt:[4026532000]"),
+		"1/root/etc/passwd": passwd("app"),
+		"2/ns/mnt":          mnt("mnt:[4026532000]"),
+		"2/root/etc/passwd": passwd("unread"),
+		"3/ns/mnt":          mnt("mnt:[4026531840]"),
+		"3/root/etc/passwd": passwd("secret"),
+		"4/root/etc/passwd": passwd("other"),
+	}
+	resolvers := NewReader(denyFS{fsys, "3/root/"}).NewProcResolvers()
+
+	resolver := func(pid uint64) *Resolver {
+		var proc Proc
+
+		proc.Stat.Pid = pid
+		return resolvers.Resolver(&proc)
+	}
+
+	var tests = []struct {
+		pid    uint64
+		expect string
+	}{
+		{1, "app"},
+		{2, "app"}, // from 1, as they share a mount namespace
+		{4, "other"},
+	}
+	for _, test := range tests {
+		r := resolver(test.pid)
+		if r == nil {
+			t.Errorf("Resolver(%d): unexpected nil\n", test.pid)
+			continue
+		}
+		name, err := r.UserName(1000)
+		if err != nil || name != test.expect {
+			t.Errorf("Resolver(%d): expected '%s', got '%s' (%v)\n", test.pid, test.expect, name, err)
+			continue
+		}
+		fmt.Printf("ok Resolver(%d).UserName(1000) == %s\n", test.pid, name)
+	}
+
+	if resolver(1) != resolver(2) {
+		t.Errorf("Resolver(): expected one Resolver for the namespace\n")
+	}
+	if r := resolver(3); r != nil {
+		t.Errorf("Resolver(3): expected nil for an unreadable root, got %v\n", r)
+	} else {
+		fmt.Printf("ok Resolver(3) == nil\n")
+	}
+}